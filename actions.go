@@ -32,17 +32,46 @@ import (
 
 // ManifestCopy copies files and versions as listed in the manifest
 // Supply a pathfunc takes the Meta and index as parameters. The output of the pathfunc will be joined with the filename as listed in manifest.
-func ManifestCopy(pathfunc func(m *Meta, index string) string) Action {
+// If the filename includes folders (e.g. images/photo.jpg), those folders are recreated within the version's folder.
+// Optionally supply hash algorithms (md5, sha1, sha256 or sha512) to compute fixity hashes as files are copied.
+// When hashing, each copied file is re-read and its hashes checked against the source before the hashes are added to the manifest.
+// If the Meta's LogEvents field is set, ManifestCopy logs a replication event (and a message digest calculation event when hashing).
+func ManifestCopy(pathfunc func(m *Meta, index string) string, algs ...string) Action {
+	checkAlgs(algs)
 	return func(m *Meta, target, index string) error {
 		man := m.Manifest[index]
+		start, copied := time.Now(), 0
 		for vidx, v := range man.Versions {
-			for _, f := range v.Files {
-				if err := wincommands.FileCopy(
-					filepath.Join(pathfunc(m, index), f.Name),
-					filepath.Join(target, "versions", strconv.Itoa(vidx))+string(filepath.Separator),
-					false); err != nil {
+			if v.listed {
+				continue // archive members listed by the Siegfried loader aren't on disk: they are unpacked by Decompress
+			}
+			for fidx, f := range v.Files {
+				name := filepath.FromSlash(f.Name)
+				src := filepath.Join(pathfunc(m, index), name)
+				dir := filepath.Join(target, "versions", strconv.Itoa(vidx), filepath.Dir(name))
+				if len(algs) == 0 {
+					if err := wincommands.FileCopy(src, dir+string(filepath.Separator), false); err != nil {
+						return err
+					}
+					copied++
+					continue
+				}
+				if err := os.MkdirAll(dir, os.ModePerm); err != nil {
 					return err
 				}
+				hashes, err := copyHash(src, filepath.Join(dir, filepath.Base(name)), algs)
+				if err != nil {
+					return err
+				}
+				man.Versions[vidx].Files[fidx].SetHashes(hashes)
+				copied++
+			}
+		}
+		if copied > 0 {
+			end := time.Now()
+			m.logEvent(index, ReplicationEvent, start, end, "Copied "+strconv.Itoa(copied)+" files into the package")
+			if len(algs) > 0 {
+				m.logEvent(index, MessageDigestCalculationEvent, start, end, "Calculated "+strings.Join(algs, ", ")+" hashes for "+strconv.Itoa(copied)+" files")
 			}
 		}
 		return nil
@@ -55,11 +84,20 @@ func IndexPath(m *Meta, index string) string {
 	return filepath.Dir(index)
 }
 
+// FolderPath is an example function that could be supplied to ManifestCopy
+// FolderPath assumes that the index holds the full path to a folder (e.g. when objects are loaded per folder), so returns the index.
+func FolderPath(m *Meta, index string) string {
+	return index
+}
+
 // SimpleManifest observes the files in the "versions" folder and builds a simple manifest based on that information.
 // It takes a fmtmap argument and path to a siegfried file.
 // The fmtmap links file extensions e.g. "pdf" to PUID + mimetype. It can be nil if you want siegfried identification only.
 // The siegfried path can be an empty string if you don't want siegfried scanning.
-func SimpleManifest(fmtmap map[string][2]string, sfpath string) Action {
+// Optionally supply hash algorithms (md5, sha1, sha256 or sha512) to compute fixity hashes for each file.
+// If the Meta's LogEvents field is set, SimpleManifest logs a format identification event (and a message digest calculation event when hashing).
+func SimpleManifest(fmtmap map[string][2]string, sfpath string, algs ...string) Action {
+	checkAlgs(algs)
 	var s *siegfried.Siegfried
 	var err error
 	if sfpath != "" {
@@ -68,6 +106,14 @@ func SimpleManifest(fmtmap map[string][2]string, sfpath string) Action {
 			panic(err)
 		}
 	}
+	// how formats are identified, for format identification events
+	var how []string
+	if len(fmtmap) > 0 {
+		how = append(how, "by file extension")
+	}
+	if s != nil {
+		how = append(how, "with siegfried")
+	}
 	if fmtmap == nil {
 		fmtmap = make(map[string][2]string)
 	}
@@ -77,11 +123,12 @@ func SimpleManifest(fmtmap map[string][2]string, sfpath string) Action {
 			man = NewManifest()
 			m.Manifest[index] = man
 		}
+		start, count := time.Now(), 0
 		for i := 0; ; i++ {
 			_, err := os.Stat(filepath.Join(target, "versions", strconv.Itoa(i)))
 			if err != nil {
 				if os.IsNotExist(err) {
-					return nil
+					break
 				}
 				return err
 			}
@@ -106,39 +153,68 @@ func SimpleManifest(fmtmap map[string][2]string, sfpath string) Action {
 				var ok bool
 				fmt, ok = fmtmap[strings.TrimPrefix(filepath.Ext(fname), ".")]
 				if !ok && s != nil {
-					f, err := os.Open(path)
-					if err == nil {
-						ids, _ := s.Identify(f, path, "")
-						if len(ids) == 1 {
-							fmt[0] = ids[0].String()
-							fmt[1] = ids[0].(pronom.Identification).MIME
-						}
+					fmt = identifyFile(s, path)
+				}
+				var hashes []Hash
+				if len(algs) > 0 {
+					hashes, err = HashFile(path, algs...)
+					if err != nil {
+						return err
 					}
-					f.Close()
 				}
 				t := info.ModTime().Truncate(time.Second)
-				files = append(files, File{
+				file := File{
 					Name:     fname,
 					Size:     info.Size(),
 					Modified: &t,
 					MIME:     fmt[1],
 					PUID:     ToPUID(fmt[0]),
-				})
+				}
+				file.SetHashes(hashes)
+				files = append(files, file)
 				return nil
 			})
 			if err != nil {
 				return err
 			}
 			man.AddVersion(files)
+			count += len(files)
+		}
+		if count > 0 {
+			end := time.Now()
+			if len(how) > 0 {
+				m.logEvent(index, FormatIdentificationEvent, start, end, "Identified the formats of "+strconv.Itoa(count)+" files "+strings.Join(how, " and "))
+			}
+			if len(algs) > 0 {
+				m.logEvent(index, MessageDigestCalculationEvent, start, end, "Calculated "+strings.Join(algs, ", ")+" hashes for "+strconv.Itoa(count)+" files")
+			}
 		}
 		return nil
 	}
 }
 
-// Progress prints progress message every n'th item processed
+// identifyFile identifies the file at path with siegfried and returns its ID and MIME type.
+// Empty strings are returned if the file can't be opened or doesn't have a single identification.
+func identifyFile(s *siegfried.Siegfried, path string) [2]string {
+	var ret [2]string
+	f, err := os.Open(path)
+	if err != nil {
+		return ret
+	}
+	defer f.Close()
+	ids, _ := s.Identify(f, path, "")
+	if len(ids) == 1 {
+		ret[0] = ids[0].String()
+		ret[1] = ids[0].(pronom.Identification).MIME
+	}
+	return ret
+}
+
+// Progress prints progress message every n'th item processed.
+// Progress counts the items processed so is wrapped with Serial to make it safe to use with OutputConcurrent.
 func Progress(i int) Action {
 	var n, j int
-	return func(m *Meta, target, index string) error {
+	return Serial(func(m *Meta, target, index string) error {
 		n++
 		j++
 		if j == i {
@@ -146,15 +222,50 @@ func Progress(i int) Action {
 			log.Printf("Processing number %d (%s)\n", n, index)
 		}
 		return nil
-	}
+	})
 }
 
 // Decompress takes a path to a siegfried signature file and a pathfunc.
 // The pathfunc returns the directory that will be joined to the filename out of the manifest.
 // It returns an action that:
-// - checks if a PUID (assuming a single version 0/ file 0) is a compressed type and recursively decompresses,
-// - adding new files to manifest and copying them to output.
+// - checks the PUIDs of the files in the latest version and recursively decompresses any archives,
+// - adding their members to the manifest as a single derived version and copying them to output.
+// The other files in the latest version are copied into the derived version too, so that it is complete.
+// Unless an archive is the only file in its version, its members are put in a folder named after it (e.g. a.zip into a_zip/).
+// Access rule targets (display, preview and text) that refer to an archive are updated to refer to its members instead,
+// and those that refer to other files are updated to refer to their copies.
+// Unpacked files keep the modification times stored in the archive and have their container-internal paths
+// (e.g. archive.zip#folder/file.txt) as their OriginalName.
+// If the manifest already lists the archive's members as a derived version (as the Siegfried loader does for results from
+// scanning within archives), that version is replaced by the unpacked files.
+// If the Meta's LogEvents field is set, Decompress logs an unpacking event, which generates the new version, and a format identification event.
+// Decompress applies the DefaultLimits: use DecompressLimits to set other limits.
 func Decompress(sfpath string) Action {
+	return DecompressLimits(sfpath, DefaultLimits)
+}
+
+// Limits guard the Decompress action against malicious or malformed archives (e.g. decompression bombs).
+// Bytes and Files limit the total size and number of the files unpacked for an object.
+// Depth limits how deeply archives within archives are unpacked: archives nested deeper are kept as files.
+// Zero values mean no limit.
+type Limits struct {
+	Bytes int64
+	Files int
+	Depth int
+}
+
+// DefaultLimits are the limits applied by Decompress
+var DefaultLimits = Limits{
+	Bytes: 10 << 30, // 10GB
+	Files: 100000,
+	Depth: 5,
+}
+
+// DecompressLimits is Decompress with the given limits.
+// Archive members with unsafe paths (absolute paths or paths that would escape the version's folder, e.g. ../../x) and
+// members that would exceed the Bytes or Files limits aren't written. These, and any nested archives not unpacked because
+// of the Depth limit, are recorded in an unpacking event Log with a warning outcome (even if the Meta's LogEvents field isn't set).
+func DecompressLimits(sfpath string, limits Limits) Action {
 	var sf *siegfried.Siegfried
 	var err error
 	if sfpath != "" {
@@ -163,108 +274,207 @@ func Decompress(sfpath string) Action {
 			panic(err)
 		}
 	}
-	repl := strings.NewReplacer(".zip#", "_zip/")
 	return func(m *Meta, target, index string) error {
 		man := m.Manifest[index]
-		if len(man.Versions) != 1 || len(man.Versions[0].Files) != 1 { // only operate on manifests with a single version/file
+		if n := len(man.Versions); n > 1 && man.Versions[n-1].listed {
+			man.Versions = man.Versions[:n-1]
+		}
+		if len(man.Versions) == 0 {
 			return nil
 		}
-		if config.IsArchive(strings.TrimPrefix(man.Versions[0].Files[0].PUID, "http://www.nationalarchives.gov.uk/pronom/")) == 0 {
+		vidx := len(man.Versions) - 1
+		var archives []string
+		isArchive := make([]bool, len(man.Versions[vidx].Files))
+		for i, f := range man.Versions[vidx].Files {
+			if config.IsArchive(strings.TrimPrefix(f.PUID, "http://www.nationalarchives.gov.uk/pronom/")) > 0 {
+				archives = append(archives, FileTarget{vidx, i}.String())
+				isArchive[i] = true
+			}
+		}
+		if len(archives) == 0 {
 			return nil
 		}
-		basedir := filepath.Join(target, "versions", "1")
-		files := make([]File, 0, 10)
-		var idRdr func(rdr io.Reader, name, mime string, sz int64) error
-		idRdr = func(rdr io.Reader, name, mime string, sz int64) error {
+		start := time.Now()
+		u := newUnpacker(limits, filepath.Join(target, "versions", strconv.Itoa(vidx+1)))
+		var idRdr func(rdr io.Reader, name, mime string, sz int64, mod time.Time, depth int) error
+		idRdr = func(rdr io.Reader, name, mime string, sz int64, mod time.Time, depth int) error {
+			if !u.admit(name, sz) {
+				return nil
+			}
 			buf, err := sf.Buffer(rdr)
 			defer sf.Put(buf)
 			if err != nil && err.Error() != "empty source" {
 				return err
 			}
 			ids, _ := sf.IdentifyBuffer(buf, nil, name, mime)
-			arc := decompress.IsArc(ids)
-			if arc > 0 {
-				dec, err := decompress.New(arc, buf, name, sz)
+			if a := decompress.IsArc(ids); a > 0 && u.nest(name, depth) {
+				dec, err := decompress.New(a, buf, name, sz)
 				if err != nil {
 					return err
 				}
 				for err = dec.Next(); err == nil; err = dec.Next() {
-					err = idRdr(dec.Reader(), dec.Path(), dec.MIME(), dec.Size()) // recurse on the contents of the archive
+					err = idRdr(dec.Reader(), dec.Path(), dec.MIME(), dec.Size(), dec.Mod(), depth+1) // recurse on the contents of the archive
 					if err != nil && err != io.EOF {
 						return err
 					}
 				}
 				return nil
 			}
-			fname := strings.TrimPrefix(name, "#")
-			path := fname
-			dir := basedir
-			fname = repl.Replace(fname)
-			var extradirs string
-			extradirs, fname = filepath.Split(fname)
-			if len(extradirs) > 0 {
-				dir = filepath.Join(dir, extradirs)
+			fmt := [2]string{"UNKNOWN", ""}
+			if len(ids) == 1 {
+				fmt[0] = ids[0].String()
+				fmt[1] = ids[0].(pronom.Identification).MIME
 			}
-			os.MkdirAll(dir, 0666)
-			f, err := os.Create(filepath.Join(dir, fname))
-			if err != nil {
-				return err
+			return u.write(name, buf.Reader(), mod, fmt[0], fmt[1])
+		}
+		srcdir := filepath.Join(target, "versions", strconv.Itoa(vidx))
+		for i, f := range man.Versions[vidx].Files {
+			f.ID = FileTarget{vidx, i}.String()
+			if !isArchive[i] {
+				if err := u.carry(f, srcdir); err != nil {
+					return err
+				}
+				continue
 			}
-			_, err = io.Copy(f, buf.Reader())
-			if err != nil && err.Error() == "empty source" {
-				err = nil
+			var prefix string
+			if len(man.Versions[vidx].Files) > 1 {
+				prefix = arcFolder(f.Name)
 			}
-			f.Close()
+			u.next(f, prefix)
+			path := filepath.Join(srcdir, filepath.FromSlash(f.Name))
+			fi, err := os.Stat(path)
 			if err != nil {
 				return err
 			}
-			fi, err := os.Stat(filepath.Join(dir, fname))
+			rdr, err := os.Open(path)
 			if err != nil {
 				return err
 			}
-			t := fi.ModTime()
-			fmt := [2]string{"UNKNOWN", ""}
-			if len(ids) == 1 {
-				fmt[0] = ids[0].String()
-				fmt[1] = ids[0].(pronom.Identification).MIME
+			err = idRdr(rdr, "", "", fi.Size(), fi.ModTime(), 0)
+			rdr.Close()
+			if err != nil && err != io.EOF {
+				return err
 			}
-			files = append(files, File{
-				Name:     path,
-				Size:     fi.Size(),
-				Modified: &t,
-				MIME:     fmt[1],
-				PUID:     ToPUID(fmt[0]),
-			})
-			return nil
 		}
-		path := filepath.Join(target, "versions", "0", man.Versions[0].Files[0].Name)
-		fi, err := os.Stat(path)
-		if err != nil {
-			return err
+		u.finish(m, index, vidx, start, archives)
+		m.logEvent(index, FormatIdentificationEvent, start, time.Now(), "Identified the formats of "+strconv.Itoa(len(u.files)-u.carried)+" unpacked files with siegfried")
+		return nil
+	}
+}
+
+// arcFolder returns the folder that an archive's members are unpacked to, e.g. a/b.zip is unpacked to a/b_zip/
+func arcFolder(name string) string {
+	ext := filepath.Ext(name)
+	if ext == "" {
+		return name + "_/"
+	}
+	return strings.TrimSuffix(name, ext) + "_" + ext[1:] + "/"
+}
+
+// safePath reports whether a path from an archive is relative and stays within the folder it is unpacked to
+func safePath(p string) bool {
+	p = strings.Replace(p, "\\", "/", -1)
+	if p == "" || strings.HasPrefix(p, "/") || (len(p) > 1 && p[1] == ':') {
+		return false
+	}
+	for _, el := range strings.Split(p, "/") {
+		if el == ".." {
+			return false
 		}
-		f, err := os.Open(path)
-		defer f.Close()
-		if err != nil {
-			return err
+	}
+	return true
+}
+
+// retarget points a target (e.g. textTarget) of each access rule in an object's manifest at files in its latest version that were derived
+// from other files (e.g. text extracted from a document). Derived maps the @ids of the original files to the indexes of their
+// derived files in the latest version. Each access rule is given the derived files of the files in its displayTarget or,
+// if it has no displayTarget, all the files in the latest version. The set func sets the target.
+// A displayTarget may refer to files in an earlier version than the originals (e.g. a document that has since been migrated
+// to PDF): these are followed through the versions derived from them to the originals (see lineage).
+func retarget(m *Meta, index string, derived map[string]int, set func(ar *AccessRule, v VarStr)) {
+	man := m.Manifest[index]
+	m.mu.Lock()
+	links := lineage(man, m.Logs[index])
+	m.mu.Unlock()
+	vidx := len(man.Versions) - 1
+	all := make([]FileTarget, len(man.Versions[vidx].Files))
+	for i := range all {
+		all[i] = FileTarget{vidx, i}
+	}
+	for i := range man.AccessRules {
+		display := strs(man.AccessRules[i].Display)
+		if len(display) == 0 {
+			set(&man.AccessRules[i], ReferenceFiles(all))
+			continue
 		}
-		err = idRdr(f, "", "", fi.Size())
-		if err != nil && err != io.EOF {
-			return err
+		var fts []FileTarget
+		seen := make(map[string]bool)
+		for len(display) > 0 {
+			ref := display[0]
+			display = display[1:]
+			if seen[ref] {
+				continue
+			}
+			seen[ref] = true
+			if idx, ok := derived[ref]; ok {
+				fts = append(fts, all[idx])
+				continue
+			}
+			display = append(display, links[ref]...)
 		}
-		man.AddVersion(files)
-		// now update access rules that have v0f0 as display target
-		fts := make([]FileTarget, len(files))
-		for i := range fts {
-			fts[i][0] = 1
-			fts[i][1] = i
+		if len(fts) > 0 {
+			set(&man.AccessRules[i], ReferenceFiles(fts))
 		}
-		blank := FileTarget{}
-		for i, ar := range man.AccessRules {
-			str, ok := ar.Display.(string)
-			if ok && str == blank.String() {
-				man.AccessRules[i].Display = ReferenceFiles(fts)
+	}
+}
+
+// sourceVersion returns the index of the latest version in a manifest that isn't made up of renditions (e.g. text or previews)
+// of another version. Versions added by ExtractText and Preview, and versions whose files are all textTargets or previewTargets
+// of access rules (e.g. as read back from a SIP), are renditions.
+func sourceVersion(man *Manifest) int {
+	targets := make(map[string]bool)
+	for _, ar := range man.AccessRules {
+		for _, ref := range append(strs(ar.Text), strs(ar.Preview)...) {
+			targets[ref] = true
+		}
+	}
+	for vidx := len(man.Versions) - 1; vidx > 0; vidx-- {
+		v := man.Versions[vidx]
+		if v.rendition {
+			continue
+		}
+		rendition := len(v.Files) > 0
+		for _, f := range v.Files {
+			rendition = rendition && targets[f.ID]
+		}
+		if !rendition {
+			return vidx
+		}
+	}
+	return 0
+}
+
+// lineage maps the @ids of files to the @ids of the files derived from them. For each derived version (a version with a
+// derivedFrom), the sources and outputs of the log that generated it are linked: pairwise when there are as many sources as
+// outputs (as logged by Migrate), otherwise each source is linked to all the outputs.
+func lineage(man *Manifest, logs []*Log) map[string][]string {
+	links := make(map[string][]string)
+	for _, v := range man.Versions {
+		if v.DerivedFrom == "" || v.GeneratedBy == "" {
+			continue
+		}
+		for _, l := range logs {
+			if l.ID != v.GeneratedBy {
+				continue
+			}
+			for i, src := range l.Sources {
+				if len(l.Sources) == len(l.Outputs) {
+					links[src] = append(links[src], l.Outputs[i])
+				} else {
+					links[src] = append(links[src], l.Outputs...)
+				}
 			}
 		}
-		return nil
 	}
+	return links
 }
@@ -0,0 +1,91 @@
+// Copyright 2018 State of New South Wales through the State Archives and Records Authority of NSW
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package meta
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSafePath(t *testing.T) {
+	for _, tc := range []struct {
+		path string
+		safe bool
+	}{
+		{"a.txt", true},
+		{"dir/sub/a.txt", true},
+		{"dir\\a.txt", true},
+		{"a..b.txt", true},
+		{"", false},
+		{"/etc/passwd", false},
+		{"\\windows\\system32", false},
+		{"C:/windows/system32", false},
+		{"../a.txt", false},
+		{"dir/../../a.txt", false},
+		{"dir\\..\\..\\a.txt", false},
+	} {
+		if got := safePath(tc.path); got != tc.safe {
+			t.Errorf("safePath(%q): expected %v, got %v", tc.path, tc.safe, got)
+		}
+	}
+}
+
+func TestArcFolder(t *testing.T) {
+	for name, expect := range map[string]string{
+		"a.zip":       "a_zip/",
+		"sub/b.tar":   "sub/b_tar/",
+		"c.tar.gz":    "c.tar_gz/",
+		"noextension": "noextension_/",
+	} {
+		if got := arcFolder(name); got != expect {
+			t.Errorf("arcFolder(%q): expected %s, got %s", name, expect, got)
+		}
+	}
+}
+
+func TestManifestCopyArchiveMembers(t *testing.T) {
+	src, err := ioutil.TempDir("", "meta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+	for _, name := range []string{"a.zip", "b.pdf"} {
+		if err = ioutil.WriteFile(filepath.Join(src, name), []byte(name), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pathfunc := func(m *Meta, index string) string { return src }
+	for _, listed := range []bool{true, false} {
+		target, err := ioutil.TempDir("", "meta")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(target)
+		m := testMeta(1)
+		man := m.Manifest[m.Index[0]]
+		man.AddVersion([]File{{Name: "a.zip"}})
+		man.AddVersion([]File{{Name: "b.pdf", OriginalName: "a.zip#b.pdf"}})
+		man.Versions[1].DerivedFrom, man.Versions[1].listed = "_:v0", listed
+		if err = ManifestCopy(pathfunc, MD5)(m, target, m.Index[0]); err != nil {
+			t.Fatal(err)
+		}
+		// members listed by the Siegfried loader aren't copied, but files that have been unpacked are
+		if _, err = os.Stat(filepath.Join(target, "versions", "1", "b.pdf")); os.IsNotExist(err) != listed {
+			t.Errorf("Copying a listed (%v) archive member, got %v", listed, err)
+		}
+	}
+}
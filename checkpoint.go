@@ -0,0 +1,141 @@
+// Copyright 2018 State of New South Wales through the State Archives and Records Authority of NSW
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package meta
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// CheckpointFile is the name of the checkpoint journal written to the target directory by Output and OutputConcurrent
+const CheckpointFile = "checkpoint.journal"
+
+// journal records the objects that have been output successfully.
+// Each line of the journal is the object's position in the Index and its index, separated by a tab.
+type journal struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+	done map[int]string
+}
+
+// openJournal opens the checkpoint journal in the target directory.
+// If resume is true, an existing journal is read and appended to, after removing any partially written last line.
+// Otherwise any existing journal is truncated.
+func openJournal(target string, resume bool) (*journal, error) {
+	if err := os.MkdirAll(target, os.ModePerm); err != nil {
+		return nil, err
+	}
+	j := &journal{
+		path: filepath.Join(target, CheckpointFile),
+		done: make(map[int]string),
+	}
+	flag := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if resume {
+		flag = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+		data, err := ioutil.ReadFile(j.path)
+		if err == nil {
+			// drop a last line only partially written before a crash, so that new lines are appended after a complete line
+			if n := bytes.LastIndexByte(data, '\n') + 1; n < len(data) {
+				if err = os.Truncate(j.path, int64(n)); err != nil {
+					return nil, err
+				}
+				data = data[:n]
+			}
+			for _, line := range strings.Split(string(data), "\n") {
+				fields := strings.SplitN(line, "\t", 2)
+				if len(fields) != 2 {
+					continue
+				}
+				i, err := strconv.Atoi(fields[0])
+				if err != nil {
+					continue
+				}
+				j.done[i] = fields[1]
+			}
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	var err error
+	j.f, err = os.OpenFile(j.path, flag, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// completed reports whether the object at position i in the Index has already been output.
+// It returns an error if the journal records a different index at that position.
+func (j *journal) completed(i int, index string) (bool, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	idx, ok := j.done[i]
+	if !ok {
+		return false, nil
+	}
+	if idx != index {
+		return false, fmt.Errorf("meta: checkpoint journal records %s at position %d but the index has %s; the index has changed since the journal was written", idx, i, index)
+	}
+	return true, nil
+}
+
+// record adds a completed object to the journal
+func (j *journal) record(i int, index string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.done[i] = index
+	_, err := j.f.WriteString(strconv.Itoa(i) + "\t" + index + "\n")
+	return err
+}
+
+// close closes the journal, leaving it in place so that the run can be resumed
+func (j *journal) close() error {
+	return j.f.Close()
+}
+
+// finish closes and removes the journal once a run has completed successfully
+func (j *journal) finish() error {
+	if err := j.f.Close(); err != nil {
+		return err
+	}
+	return os.Remove(j.path)
+}
+
+// checkpoint outputs the object at position i in the Index unless the journal records that it has already been output.
+// When resuming, any partially written output directory for the object is removed before it is re-done.
+// Objects that fail when collecting errors aren't recorded in the journal.
+func (m *Meta) checkpoint(j *journal, target string, i int, actions []Action) error {
+	index := m.Index[i]
+	done, err := j.completed(i, index)
+	if err != nil || done {
+		return err
+	}
+	if m.Resume {
+		if err := os.RemoveAll(filepath.Join(target, strconv.Itoa(i))); err != nil {
+			return err
+		}
+	}
+	if name, err := m.output(target, i, actions); err != nil {
+		return m.Fail(index, name, err)
+	}
+	return j.record(i, index)
+}
@@ -0,0 +1,92 @@
+// Copyright 2018 State of New South Wales through the State Archives and Records Authority of NSW
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package meta
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "meta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	m := testMeta(10)
+	fail := errors.New("disk full")
+	err = m.Output(dir, func(m *Meta, target, index string) error {
+		if index == "object6" {
+			ioutil.WriteFile(filepath.Join(target, "partial"), []byte("partial"), os.ModePerm)
+			return fail
+		}
+		return nil
+	})
+	if err != fail {
+		t.Fatalf("Expecting error from action, got %v", err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, CheckpointFile)); err != nil {
+		t.Fatalf("Expecting a checkpoint journal after a failed run, got %v", err)
+	}
+	m = testMeta(10)
+	m.Resume = true
+	var processed []string
+	err = m.Output(dir, func(m *Meta, target, index string) error {
+		processed = append(processed, index)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(processed) != 4 || processed[0] != "object6" {
+		t.Errorf("Expecting objects 6 to 9 to be processed on resume, got %v", processed)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "6", "partial")); !os.IsNotExist(err) {
+		t.Errorf("Expecting partially written directory to be removed on resume, got %v", err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, CheckpointFile)); !os.IsNotExist(err) {
+		t.Errorf("Expecting checkpoint journal to be removed after a successful run, got %v", err)
+	}
+}
+
+func TestResumePartialLine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "meta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, CheckpointFile)
+	if err = ioutil.WriteFile(path, []byte("0\tobject0\n1\tobj"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	j, err := openJournal(dir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = j.record(1, "object1"); err != nil {
+		t.Fatal(err)
+	}
+	j.close()
+	byt, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(byt) != "0\tobject0\n1\tobject1\n" {
+		t.Errorf("Expecting the partial line to be replaced, got %q", byt)
+	}
+}
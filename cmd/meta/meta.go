@@ -21,6 +21,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"bitbucket.org/srnsw/meta"
@@ -28,6 +29,9 @@ import (
 
 var (
 	blacklistf  = flag.String("blacklist", "", "comma-separated list of IDs to blacklist e.g. x-fmt/111,fmt/10")
+	identifierf = flag.String("identifier", "", "preferred identifier when the results file has more than one e.g. pronom")
+	warningsf   = flag.Bool("warnings", false, "record identification warnings in a log for each object")
+	filterf     = flag.Bool("filter", false, "exclude system and temporary files (e.g. Thumbs.db, ~$ files, empty files) and list them in exclusions.csv")
 	agencyf     = flag.Int("agency", 0, "agency ID e.g. 15")
 	agencyNamef = flag.String("agencyName", "", "agency name e.g. State Archives and Records Authority of NSW")
 	seriesf     = flag.Int("series", 0, "series ID e.g. 15")
@@ -38,14 +42,82 @@ var (
 	executef    = flag.String("execute", "", "access rule execution date e.g. 2015-01-31")
 	outputf     = flag.String("output", "", "output directory e.g. c:/users/richardl/Desktop")
 	contentf    = flag.String("content", "", "content directory e.g. c:/users/richardl/stuff")
+	groupf      = flag.Bool("group", false, "make one object per folder rather than per file")
+	workersf    = flag.Int("workers", 1, "number of objects to process in parallel e.g. 8")
+	resumef     = flag.Bool("resume", false, "resume a failed run, skipping objects already output")
+	hashf       = flag.String("hash", "", "comma-separated list of hash algorithms to compute when copying e.g. md5,sha256")
+	collectf    = flag.Bool("collect", false, "collect errors for individual objects in a report and continue")
+	eventsf     = flag.Bool("events", false, "record copying and hashing as preservation events in each object's logs")
+	decompressf = flag.String("decompress", "", "path to a siegfried signature file for unpacking archives e.g. c:/users/richardl/siegfried/default.sig")
 )
 
+// validate checks the SIPs in an output directory for broken internal references
+func validate(dir string) {
+	m, err := meta.New(meta.SIPDir(dir))
+	if err != nil {
+		fmt.Printf("meta: error reading SIPs: %v", err)
+		os.Exit(1)
+	}
+	if err = m.Validate(); err != nil {
+		fmt.Print(err)
+		os.Exit(1)
+	}
+	fmt.Printf("meta: %d SIPs validated", len(m.Index))
+}
+
+// verify audits the files in the SIPs in an output directory against their manifests
+func verify(dir string) {
+	ds, err := meta.Verify(dir)
+	if err != nil {
+		fmt.Printf("meta: error verifying SIPs: %v", err)
+		os.Exit(1)
+	}
+	for _, d := range ds {
+		fmt.Println(d)
+	}
+	if len(ds) > 0 {
+		fmt.Printf("meta: %d discrepancies found", len(ds))
+		os.Exit(1)
+	}
+	fmt.Print("meta: SIPs verified")
+}
+
 func main() {
 	flag.Parse()
 	if len(flag.Args()) < 1 {
 		fmt.Print("meta: expecting a siegfried results file as input e.g. `meta my_results.yaml`")
 		os.Exit(1)
 	}
+	if flag.Arg(0) == "validate" {
+		if len(flag.Args()) < 2 {
+			fmt.Print("meta: expecting an output directory to validate e.g. `meta validate c:/users/richardl/Desktop`")
+			os.Exit(1)
+		}
+		validate(flag.Arg(1))
+		return
+	}
+	if flag.Arg(0) == "verify" {
+		if len(flag.Args()) < 2 {
+			fmt.Print("meta: expecting an output directory to verify e.g. `meta verify c:/users/richardl/Desktop`")
+			os.Exit(1)
+		}
+		verify(flag.Arg(1))
+		return
+	}
+	var algs []string
+	if *hashf != "" {
+		algs = strings.Split(*hashf, ",")
+		if err := meta.CheckAlgorithms(algs...); err != nil {
+			fmt.Print(err)
+			os.Exit(1)
+		}
+	}
+	if *decompressf != "" {
+		if _, err := os.Stat(*decompressf); err != nil {
+			fmt.Printf("meta: error opening signature file: %v", err)
+			os.Exit(1)
+		}
+	}
 	f, err := os.Open(flag.Arg(0))
 	if err != nil {
 		fmt.Printf("meta: error opening results file: %v", err)
@@ -61,7 +133,14 @@ func main() {
 		fmt.Printf("meta: error creating siegfried loader: %v", err)
 		os.Exit(1)
 	}
+	sl.Identifier, sl.Warnings, sl.Members = *identifierf, *warningsf, *decompressf != ""
+	if *filterf {
+		sl.Filter = meta.DefaultFilter()
+	}
 	loaders := []meta.Loader{sl}
+	if *groupf {
+		loaders = append(loaders, meta.Group(meta.ByFolder))
+	}
 	// now deal with flags
 	if *agencyf > 0 {
 		loaders = append(loaders, meta.Agency{*agencyNamef, *agencyf})
@@ -85,15 +164,41 @@ func main() {
 		output = *outputf
 	}
 	pathfunc := meta.IndexPath
+	if *groupf {
+		pathfunc = meta.FolderPath
+	}
 	if *contentf != "" {
 		pathfunc = func(m *meta.Meta, index string) string {
 			return *contentf
 		}
 	}
-	m, err := meta.New(loaders...)
+	newMeta := meta.New
+	if *collectf {
+		newMeta = meta.NewCollect
+	}
+	m, err := newMeta(loaders...)
 	if err != nil {
-		fmt.Printf("meta: error creating meta: %v", err)
-		os.Exit(1)
+		if _, ok := err.(meta.Failures); !ok {
+			fmt.Printf("meta: error creating meta: %v", err)
+			os.Exit(1)
+		}
+		fmt.Println(err)
+	}
+	if *filterf {
+		if err = sl.Filter.Excluded.WriteReport(filepath.Join(output, meta.ExclusionsFile)); err != nil {
+			fmt.Printf("meta: error writing exclusions report: %v", err)
+			os.Exit(1)
+		}
+	}
+	m.Resume, m.LogEvents = *resumef, *eventsf
+	actions := []meta.Action{meta.ManifestCopy(pathfunc, algs...)}
+	if *decompressf != "" {
+		actions = append(actions, meta.Decompress(*decompressf))
+	}
+	actions = append(actions, meta.Progress(1))
+	if *workersf > 1 {
+		fmt.Print(m.OutputConcurrent(output, *workersf, actions...))
+		return
 	}
-	fmt.Print(m.Output(output, meta.ManifestCopy(pathfunc), meta.Progress(1)))
+	fmt.Print(m.Output(output, actions...))
 }
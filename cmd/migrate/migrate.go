@@ -0,0 +1,58 @@
+// Copyright 2018 State of New South Wales through the State Archives and Records Authority of NSW
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Migrate cmd swaps the placeholder references (obj:N, mig:N and log:N) in SIPs generated by the meta package for UUIDs.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"bitbucket.org/srnsw/meta/migrate"
+)
+
+var (
+	seedf    = flag.Int64("seed", 0, "seed for reproducible UUIDs e.g. 42 (random UUIDs are generated if the flag is not set)")
+	mappingf = flag.String("mapping", "", "path for the placeholder to UUID mapping file e.g. c:/users/richardl/mapping.json (defaults to migrate.json in the output directory)")
+)
+
+func main() {
+	flag.Parse()
+	if len(flag.Args()) < 1 {
+		fmt.Print("migrate: expecting an output directory as input e.g. `migrate c:/users/richardl/Desktop`")
+		os.Exit(1)
+	}
+	dir := flag.Arg(0)
+	mig := migrate.New()
+	flag.Visit(func(f *flag.Flag) { // any seed, including 0, is used if the flag is set
+		if f.Name == "seed" {
+			mig = migrate.NewSeeded(*seedf)
+		}
+	})
+	if err := mig.Dir(dir); err != nil {
+		fmt.Printf("migrate: error swapping placeholders: %v", err)
+		os.Exit(1)
+	}
+	mapping := *mappingf
+	if mapping == "" {
+		mapping = filepath.Join(dir, "migrate.json")
+	}
+	if err := mig.WriteMapping(mapping); err != nil {
+		fmt.Printf("migrate: error writing mapping file: %v", err)
+		os.Exit(1)
+	}
+	fmt.Printf("migrate: swapped %d placeholders, mapping written to %s", len(mig.Mapping), mapping)
+}
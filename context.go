@@ -25,6 +25,33 @@ import (
 // Context generates the @context field in json output
 type Context map[string]Field
 
+// UnmarshalJSON makes Context a json Unmarshaller so that object fields are unmarshalled as Objs
+func (c *Context) UnmarshalJSON(b []byte) error {
+	var raws map[string]json.RawMessage
+	if err := json.Unmarshal(b, &raws); err != nil {
+		return err
+	}
+	ctx := make(Context)
+	for k, raw := range raws {
+		raw = bytes.TrimSpace(raw)
+		if len(raw) > 0 && raw[0] == '{' {
+			var obj Obj
+			if err := json.Unmarshal(raw, &obj); err != nil {
+				return err
+			}
+			ctx[k] = obj
+			continue
+		}
+		var str string
+		if err := json.Unmarshal(raw, &str); err != nil {
+			return err
+		}
+		ctx[k] = str
+	}
+	*c = ctx
+	return nil
+}
+
 // Fields are typically plain strings or objects with @id/@type
 type Field interface{}
 
@@ -0,0 +1,293 @@
+// Copyright 2018 State of New South Wales through the State Archives and Records Authority of NSW
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package meta
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CSVLoader loads metadata from a CSV file (e.g. an agency spreadsheet) that has a header row.
+//
+// Rows are joined to existing index entries using the values in the Key column (e.g. a file path).
+// Use KeyFunc to normalise key values so they match the index.
+// Rows that don't match an index entry are failures unless Create is set, in which case new objects are created
+// and indexed by their key.
+//
+// The Mapping links column headers to metadata fields. Fields are named as they are in metadata.json:
+//   - title, description, agencyIdentifier, provenance, deliveryMethod, documentType, duration and isPartOf
+//     are set to the column's value;
+//   - created and modified are parsed as W3C dates (e.g. 2006-01-02) or, if a DateLayout is given, using that layout;
+//   - series and consignment can be numbers (e.g. 21404) or IRIs;
+//   - authority and class add a disposal rule to any the object already has;
+//   - creator, creatorPerson and creatorOrganization add plain, schema.org Person or schema.org Organization agents;
+//   - source, language, subtitles, director, actor and productionCompany are VarStrs.
+//
+// If a Delimiter is given, the values of creator and VarStr columns are split on that delimiter.
+// Columns that need other handling can be mapped to funcs using Custom. These run after the mapped columns are set,
+// sorted by column header.
+type CSVLoader struct {
+	Path       string
+	LazyQuotes bool
+	Key        string
+	KeyFunc    func(key string) string
+	Create     bool
+	Mapping    map[string]string
+	DateLayout string
+	Delimiter  string
+	Custom     map[string]func(met *Metadata, value string) error
+}
+
+func (c CSVLoader) Load(m *Meta) error {
+	f, err := os.Open(c.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	rdr := csv.NewReader(f)
+	rdr.LazyQuotes = c.LazyQuotes
+	head, err := rdr.Read()
+	if err != nil {
+		return err
+	}
+	cols := make(map[string]int)
+	for i, h := range head {
+		// drop any byte order mark (e.g. from a CSV saved by Excel)
+		cols[strings.TrimSpace(strings.TrimPrefix(h, "\ufeff"))] = i
+	}
+	key, ok := cols[c.Key]
+	if !ok {
+		return fmt.Errorf("meta: CSV loader can't find key column %q in %s", c.Key, c.Path)
+	}
+	// apply mapped columns in the order they appear in the CSV
+	mapped := make([]string, 0, len(c.Mapping))
+	for col, fld := range c.Mapping {
+		if _, ok := cols[col]; !ok {
+			return fmt.Errorf("meta: CSV loader can't find mapped column %q in %s", col, c.Path)
+		}
+		if !csvFields[fld] {
+			return fmt.Errorf("meta: CSV loader can't map column %q to unknown metadata field %s", col, fld)
+		}
+		mapped = append(mapped, col)
+	}
+	sort.Slice(mapped, func(i, j int) bool { return cols[mapped[i]] < cols[mapped[j]] })
+	// run custom funcs in the order of their column headers, so results don't depend on map order
+	custom := make([]string, 0, len(c.Custom))
+	for col := range c.Custom {
+		if _, ok := cols[col]; !ok {
+			return fmt.Errorf("meta: CSV loader can't find custom column %q in %s", col, c.Path)
+		}
+		custom = append(custom, col)
+	}
+	sort.Strings(custom)
+	for row, err := rdr.Read(); err != io.EOF; row, err = rdr.Read() {
+		if err != nil {
+			return err
+		}
+		k := row[key]
+		if c.KeyFunc != nil {
+			k = c.KeyFunc(k)
+		}
+		met, ok := m.Metadata[k]
+		if !ok {
+			if !c.Create {
+				if err = m.Fail(k, "meta.CSVLoader", fmt.Errorf("meta: CSV loader has no index entry for key %s", k)); err != nil {
+					return err
+				}
+				continue
+			}
+			met = NewMetadata(len(m.Index), "")
+			m.Index = append(m.Index, k)
+			m.Metadata[k] = met
+			m.Manifest[k] = NewManifest()
+		}
+		for _, col := range mapped {
+			val := strings.TrimSpace(row[cols[col]])
+			if val == "" {
+				continue
+			}
+			if err = c.set(met, c.Mapping[col], val); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			for _, col := range custom {
+				if err = c.Custom[col](met, row[cols[col]]); err != nil {
+					break
+				}
+			}
+		}
+		if err = m.Fail(k, "meta.CSVLoader", err); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// csvFields are the metadata fields a CSVLoader can map columns to
+var csvFields = map[string]bool{
+	"title":               true,
+	"description":         true,
+	"agencyIdentifier":    true,
+	"provenance":          true,
+	"deliveryMethod":      true,
+	"documentType":        true,
+	"duration":            true,
+	"isPartOf":            true,
+	"created":             true,
+	"modified":            true,
+	"series":              true,
+	"consignment":         true,
+	"authority":           true,
+	"class":               true,
+	"creator":             true,
+	"creatorPerson":       true,
+	"creatorOrganization": true,
+	"source":              true,
+	"language":            true,
+	"subtitles":           true,
+	"director":            true,
+	"actor":               true,
+	"productionCompany":   true,
+}
+
+// split splits a value on the CSVLoader's delimiter
+func (c CSVLoader) split(val string) []string {
+	if c.Delimiter == "" {
+		return []string{val}
+	}
+	vals := strings.Split(val, c.Delimiter)
+	ret := make([]string, 0, len(vals))
+	for _, v := range vals {
+		if v = strings.TrimSpace(v); v != "" {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
+// varStr splits a value and returns a VarStr
+func (c CSVLoader) varStr(val string) VarStr {
+	vals := c.split(val)
+	if len(vals) == 1 {
+		return vals[0]
+	}
+	return SetVarStr(vals)
+}
+
+// date parses a value as a W3C date or using the CSVLoader's date layout
+func (c CSVLoader) date(val string) (*W3CDate, error) {
+	if c.DateLayout == "" {
+		d, err := ParseDate(val)
+		if err != nil {
+			return nil, err
+		}
+		return &d, nil
+	}
+	return ParseDateLayout(c.DateLayout, val)
+}
+
+// set sets a metadata field by name
+func (c CSVLoader) set(met *Metadata, fld, val string) error {
+	var err error
+	switch fld {
+	case "title":
+		met.Title = val
+	case "description":
+		met.Description = val
+	case "agencyIdentifier":
+		met.AgencyID = val
+	case "provenance":
+		met.Provenance = val
+	case "deliveryMethod":
+		met.DeliveryMethod = val
+	case "documentType":
+		met.DocumentType = val
+	case "duration":
+		met.Duration = val
+	case "isPartOf":
+		met.IsPartOf = val
+	case "created":
+		met.Created, err = c.date(val)
+	case "modified":
+		met.Modified, err = c.date(val)
+	case "series":
+		if i, e := strconv.Atoi(val); e == nil {
+			met.Series = ToSeries(i)
+		} else {
+			met.Series = val
+		}
+	case "consignment":
+		if i, e := strconv.Atoi(val); e == nil {
+			met.Consignment = ToConsignment(i)
+		} else {
+			met.Consignment = val
+		}
+	case "authority", "class":
+		// fill in the last disposal rule, or add a new rule to any existing rules if the last already has this field
+		var rules []DisposalRule
+		switch r := met.DisposalRule.(type) {
+		case DisposalRule:
+			rules = []DisposalRule{r}
+		case []DisposalRule:
+			rules = append(rules, r...)
+		}
+		n := len(rules) - 1
+		if n < 0 || (fld == "authority" && rules[n].Authority != "") || (fld == "class" && rules[n].Class != "") {
+			rules = append(rules, DisposalRule{})
+			n++
+		}
+		if fld == "authority" {
+			rules[n].Authority = val
+		} else {
+			rules[n].Class = val
+		}
+		if len(rules) == 1 {
+			met.DisposalRule = rules[0]
+		} else {
+			met.DisposalRule = rules
+		}
+	case "creator", "creatorPerson", "creatorOrganization":
+		for _, v := range c.split(val) {
+			agent := MakeAgent(v, "", "")
+			if fld == "creatorPerson" {
+				agent = MakeSDOPerson(v)
+			} else if fld == "creatorOrganization" {
+				agent = MakeOrganization(v)
+			}
+			met.Creator = AppendAgent(met.Creator, agent)
+		}
+	case "source":
+		met.Source = c.varStr(val)
+	case "language":
+		met.Language = c.varStr(val)
+	case "subtitles":
+		met.Subtitles = c.varStr(val)
+	case "director":
+		met.Director = c.varStr(val)
+	case "actor":
+		met.Actor = c.varStr(val)
+	case "productionCompany":
+		met.ProductionCompany = c.varStr(val)
+	default:
+		return fmt.Errorf("meta: CSV loader can't map to unknown metadata field %s", fld)
+	}
+	return err
+}
@@ -0,0 +1,155 @@
+// Copyright 2018 State of New South Wales through the State Archives and Records Authority of NSW
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package meta
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testCSV = `File,Name,Date,Authors,Langs,Series,DA,Class
+C:\stuff\object0,Minutes of meeting,31/12/1999,Jane Citizen; John Citizen,en;fr,21404,GA28,1.1.1
+C:\stuff\object1,Agenda,01/01/2000,Jane Citizen,en,21404,GA28,1.1.2
+C:\stuff\object9,Unmatched,02/01/2000,,,,,
+`
+
+func TestCSVLoader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "meta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "agency.csv")
+	// start with a byte order mark, as Excel does
+	if err = ioutil.WriteFile(path, []byte("\ufeff"+testCSV), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	m := testMeta(2)
+	m.CollectErrors = true
+	c := CSVLoader{
+		Path:    path,
+		Key:     "File",
+		KeyFunc: func(k string) string { return strings.TrimPrefix(k, `C:\stuff\`) },
+		Mapping: map[string]string{
+			"Name":    "title",
+			"Date":    "created",
+			"Authors": "creatorPerson",
+			"Langs":   "language",
+			"Series":  "series",
+			"DA":      "authority",
+			"Class":   "class",
+		},
+		DateLayout: SlashDMY,
+		Delimiter:  ";",
+	}
+	if err = c.Load(m); err != nil {
+		t.Fatal(err)
+	}
+	met := m.Metadata["object0"]
+	if met.Title != "Minutes of meeting" || met.Created.String() != "1999-12-31" || met.Series != ToSeries(21404) {
+		t.Errorf("Unexpected metadata %v", met)
+	}
+	if agents, ok := met.Creator.([]Agent); !ok || len(agents) != 2 {
+		t.Errorf("Expecting two creators, got %v", met.Creator)
+	}
+	if langs, ok := met.Language.([]string); !ok || len(langs) != 2 {
+		t.Errorf("Expecting two languages, got %v", met.Language)
+	}
+	if met.DisposalRule != (DisposalRule{"GA28", "1.1.1"}) {
+		t.Errorf("Unexpected disposal rule %v", met.DisposalRule)
+	}
+	if m.Metadata["object1"].Language != "en" {
+		t.Errorf("Expecting a single language, got %v", m.Metadata["object1"].Language)
+	}
+	if fs := m.Failed(); len(fs) != 1 || fs[0].Index != "object9" {
+		t.Errorf("Expecting a failure for the unmatched row, got %v", fs)
+	}
+	// create objects for unmatched rows
+	c.Create = true
+	m = testMeta(2)
+	if err = c.Load(m); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Index) != 3 || m.Metadata["object9"].Title != "Unmatched" || m.Metadata["object9"].ID != ReferenceObject(2) {
+		t.Errorf("Expecting a new object for the unmatched row, got %v", m.Index)
+	}
+}
+
+func TestCSVLoaderCustom(t *testing.T) {
+	dir, err := ioutil.TempDir("", "meta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "agency.csv")
+	if err = ioutil.WriteFile(path, []byte(testCSV), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	appendTitle := func(met *Metadata, value string) error {
+		met.Title += "[" + value + "]"
+		return nil
+	}
+	c := CSVLoader{
+		Path:    path,
+		Key:     "File",
+		KeyFunc: func(k string) string { return strings.TrimPrefix(k, `C:\stuff\`) },
+		Mapping: map[string]string{"Name": "title"},
+		Custom:  map[string]func(met *Metadata, value string) error{"Series": appendTitle, "Class": appendTitle, "DA": appendTitle},
+	}
+	for i := 0; i < 10; i++ {
+		m := testMeta(2)
+		m.CollectErrors = true
+		if err = c.Load(m); err != nil {
+			t.Fatal(err)
+		}
+		if title := m.Metadata["object0"].Title; title != "Minutes of meeting[1.1.1][GA28][21404]" {
+			t.Fatalf("Expecting custom funcs to run in order of their columns, got %s", title)
+		}
+	}
+}
+
+func TestCSVLoaderDisposal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "meta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "agency.csv")
+	if err = ioutil.WriteFile(path, []byte(testCSV), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	m := testMeta(2)
+	m.CollectErrors = true
+	m.Metadata["object0"].DisposalRule = []DisposalRule{{"GA45", "2.1"}, {"GA46", "3.1"}}
+	m.Metadata["object1"].DisposalRule = DisposalRule{"GA45", "2.2"}
+	c := CSVLoader{
+		Path:    path,
+		Key:     "File",
+		KeyFunc: func(k string) string { return strings.TrimPrefix(k, `C:\stuff\`) },
+		Mapping: map[string]string{"DA": "authority", "Class": "class"},
+	}
+	if err = c.Load(m); err != nil {
+		t.Fatal(err)
+	}
+	if rules, ok := m.Metadata["object0"].DisposalRule.([]DisposalRule); !ok || len(rules) != 3 || rules[2] != (DisposalRule{"GA28", "1.1.1"}) {
+		t.Errorf("Expecting the rule to be added to the existing rules, got %v", m.Metadata["object0"].DisposalRule)
+	}
+	if rules, ok := m.Metadata["object1"].DisposalRule.([]DisposalRule); !ok || len(rules) != 2 || rules[0] != (DisposalRule{"GA45", "2.2"}) || rules[1] != (DisposalRule{"GA28", "1.1.2"}) {
+		t.Errorf("Expecting the rule to be added to the existing rule, got %v", m.Metadata["object1"].DisposalRule)
+	}
+}
@@ -15,6 +15,7 @@
 package meta
 
 import (
+	"encoding/json"
 	"errors"
 	"time"
 )
@@ -66,6 +67,23 @@ func (d W3CDate) MarshalJSON() ([]byte, error) {
 	return b, nil
 }
 
+// UnmarshalJSON makes W3CDate a json Unmarshaller. The precision of the date (yyyy-mm-dd, yyyy-mm or yyyy) is preserved.
+func (d *W3CDate) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		return nil
+	}
+	var str string
+	if err := json.Unmarshal(b, &str); err != nil {
+		return err
+	}
+	pd, err := ParseDate(str)
+	if err != nil {
+		return err
+	}
+	*d = pd
+	return nil
+}
+
 // NewDate returns a reference to W3CDate from a W3C style date string.
 // If the string provided is an invalid date, a nil reference is returned.
 func NewDate(d string) *W3CDate {
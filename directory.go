@@ -0,0 +1,141 @@
+// Copyright 2018 State of New South Wales through the State Archives and Records Authority of NSW
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package meta
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/richardlehane/siegfried"
+)
+
+// Directory loader. Walks a content directory to generate generic digital objects without needing a siegfried results file.
+// By default one object is created per file and objects are indexed by file path (use IndexPath with ManifestCopy).
+// If PerFolder is set, one object is created for each folder that contains files and objects are indexed by folder path
+// (use FolderPath with ManifestCopy).
+// Set a Filter to skip files e.g. DefaultFilter().
+type Directory struct {
+	Root      string
+	PerFolder bool
+	Hash      []string // hash algorithms e.g. md5
+	Filter    *Filter
+	sf        *siegfried.Siegfried
+}
+
+// NewDirectory takes the path to a content directory, whether to create objects per folder, and an optional path to a
+// siegfried signature file (an empty string means no format identification). Hash algorithms (md5, sha1, sha256 or sha512)
+// can also be supplied to compute fixity hashes for each file.
+func NewDirectory(root string, perFolder bool, sfpath string, algs ...string) (*Directory, error) {
+	for _, alg := range algs {
+		if _, err := newHash(alg); err != nil {
+			return nil, err
+		}
+	}
+	d := &Directory{
+		Root:      root,
+		PerFolder: perFolder,
+		Hash:      algs,
+	}
+	if sfpath != "" {
+		sf, err := siegfried.Load(sfpath)
+		if err != nil {
+			return nil, err
+		}
+		d.sf = sf
+	}
+	return d, nil
+}
+
+func (d *Directory) Load(m *Meta) error {
+	folders := make(map[string][]File)
+	order := make([]string, 0, 100)
+	err := filepath.Walk(d.Root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return m.Fail(path, "meta.Directory", err)
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		var fmt [2]string
+		if d.sf != nil {
+			fmt = identifyFile(d.sf, path)
+		}
+		if d.Filter.Exclude(path, info.Size(), fmt[0]) {
+			return nil
+		}
+		file, err := d.file(path, info, fmt)
+		if err != nil {
+			return m.Fail(path, "meta.Directory", err)
+		}
+		if d.PerFolder {
+			dir := filepath.Dir(path)
+			if _, ok := folders[dir]; !ok {
+				order = append(order, dir)
+			}
+			folders[dir] = append(folders[dir], file)
+			return nil
+		}
+		met, man := NewMetadata(len(m.Index), strings.TrimSuffix(info.Name(), filepath.Ext(info.Name()))), NewManifest()
+		met.Created = WrapDate(*file.Modified)
+		man.AddVersion([]File{file})
+		m.Index = append(m.Index, path)
+		m.Metadata[path] = met
+		m.Manifest[path] = man
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, dir := range order {
+		files := folders[dir]
+		met, man := NewMetadata(len(m.Index), filepath.Base(dir)), NewManifest()
+		// the folder's created date is the earliest modified date of its files
+		created := *files[0].Modified
+		for _, f := range files[1:] {
+			if f.Modified.Before(created) {
+				created = *f.Modified
+			}
+		}
+		met.Created = WrapDate(created)
+		man.AddVersion(files)
+		m.Index = append(m.Index, dir)
+		m.Metadata[dir] = met
+		m.Manifest[dir] = man
+	}
+	return nil
+}
+
+// file describes the file at path, with format fmt, for a manifest, hashing it if configured to do so
+func (d *Directory) file(path string, info os.FileInfo, fmt [2]string) (File, error) {
+	t := info.ModTime().Truncate(time.Second)
+	file := File{
+		Name:     info.Name(),
+		Size:     info.Size(),
+		Modified: &t,
+	}
+	if d.sf != nil {
+		file.PUID, file.MIME = ToPUID(fmt[0]), fmt[1]
+	}
+	if len(d.Hash) > 0 {
+		hashes, err := HashFile(path, d.Hash...)
+		if err != nil {
+			return file, err
+		}
+		file.SetHashes(hashes)
+	}
+	return file, nil
+}
@@ -0,0 +1,70 @@
+// Copyright 2018 State of New South Wales through the State Archives and Records Authority of NSW
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package meta
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testContent(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "meta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.txt", filepath.Join("web", "index.html"), filepath.Join("web", "logo.png"), filepath.Join("web", "images", "photo.jpg")} {
+		path := filepath.Join(dir, name)
+		if err = os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(path, []byte(name), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestDirectory(t *testing.T) {
+	dir := testContent(t)
+	defer os.RemoveAll(dir)
+	d, err := NewDirectory(dir, false, "", MD5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := New(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Index) != 4 || m.Index[0] != filepath.Join(dir, "a.txt") {
+		t.Fatalf("Expecting 4 objects, got %v", m.Index)
+	}
+	f := m.Manifest[m.Index[0]].Versions[0].Files[0]
+	if m.Metadata[m.Index[0]].Title != "a" || f.Size != 5 || f.Modified == nil || f.Hash == nil {
+		t.Errorf("Unexpected object %v %v", m.Metadata[m.Index[0]], f)
+	}
+	d.PerFolder = true
+	m, err = New(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Index) != 3 || m.Metadata[filepath.Join(dir, "web")].Title != "web" {
+		t.Fatalf("Expecting 3 folder objects, got %v", m.Index)
+	}
+	if files := m.Manifest[filepath.Join(dir, "web")].Versions[0].Files; len(files) != 2 {
+		t.Errorf("Expecting 2 files in the web folder, got %v", files)
+	}
+}
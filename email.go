@@ -0,0 +1,331 @@
+// Copyright 2018 State of New South Wales through the State Archives and Records Authority of NSW
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package meta
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EmailLoader loads email messages from .eml files and mbox archives (.mbox or .mbx files).
+// Path is a single .eml or mbox file, or a folder that is searched for them. One object is created for each message:
+//   - the title is the message's subject;
+//   - the creator is the sender and the recipient is the recipients (To, Cc and Bcc), as Agents identified by mailto: URIs;
+//   - created is the date the message was sent;
+//   - version 0 is the raw message, as an .eml file;
+//   - the agencyIdentifier is the message's Message-ID (as a mid: URI); and
+//   - attachments, if any, are version 1, which is derived from the message. Each attachment isPartOf the message file (_:v0f0).
+//
+// Messages within mbox archives and attachments aren't files that can be copied from the content directory, so the loader
+// writes each object's files to a numbered folder within Dir. Objects are indexed by that folder: use FolderPath with ManifestCopy.
+// If the Meta's LogEvents field is set, extracting attachments is logged as an unpacking event which generates version 1.
+type EmailLoader struct {
+	Path string
+	Dir  string
+}
+
+func (e EmailLoader) Load(m *Meta) error {
+	var paths []string
+	err := filepath.Walk(e.Path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return m.Fail(path, "meta.EmailLoader", err)
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".eml", ".mbox", ".mbx":
+			paths = append(paths, path)
+		default:
+			if path == e.Path {
+				paths = append(paths, path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			if err = m.Fail(path, "meta.EmailLoader", err); err != nil {
+				return err
+			}
+			continue
+		}
+		err = e.load(m, bufio.NewReader(f), path)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// load adds objects for the message in an eml file, or the messages in an mbox archive, read from rdr.
+// Mbox archives are read a message at a time, rather than all at once, as they can be large.
+func (e EmailLoader) load(m *Meta, rdr *bufio.Reader, path string) error {
+	ext := strings.ToLower(filepath.Ext(path))
+	if head, _ := rdr.Peek(5); ext != ".mbox" && ext != ".mbx" && string(head) != "From " {
+		raw, err := ioutil.ReadAll(rdr)
+		if err == nil {
+			err = e.message(m, raw, filepath.Base(path), path)
+		}
+		return m.Fail(path, "meta.EmailLoader", err)
+	}
+	base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	var n int
+	return m.Fail(path, "meta.EmailLoader", readMbox(rdr, func(raw []byte) error {
+		n++
+		orig := path + "#" + strconv.Itoa(n)
+		return m.Fail(orig, "meta.EmailLoader", e.message(m, raw, base+"-"+strconv.Itoa(n)+".eml", orig))
+	}))
+}
+
+// message adds an object for a raw email message. The name is the name to give the message file and orig is its original path.
+func (e EmailLoader) message(m *Meta, raw []byte, name, orig string) error {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return fmt.Errorf("meta: error reading email message %s: %v", orig, err)
+	}
+	atts, err := attachments(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), "", msg.Body)
+	if err != nil {
+		return fmt.Errorf("meta: error reading attachments of email message %s: %v", orig, err)
+	}
+	dec := new(mime.WordDecoder)
+	subject, err := dec.DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		subject = msg.Header.Get("Subject")
+	}
+	if subject == "" {
+		subject = "(no subject)"
+	}
+	met := NewMetadata(len(m.Index), subject)
+	met.Creator = mailAgents(msg.Header, "From")
+	met.Recipient = mailAgents(msg.Header, "To", "Cc", "Bcc")
+	var modified *time.Time
+	if t, err := msg.Header.Date(); err == nil {
+		met.Created, modified = WrapDate(t), &t
+	}
+	if id := strings.Trim(msg.Header.Get("Message-Id"), "<> "); id != "" {
+		met.AgencyID = "mid:" + id
+	}
+	// write the message and its attachments
+	dir := filepath.Join(e.Dir, strconv.Itoa(len(m.Index)))
+	if err = os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	write := func(name string, byt []byte) error {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, byt, os.ModePerm); err != nil {
+			return err
+		}
+		if modified != nil {
+			return os.Chtimes(path, *modified, *modified)
+		}
+		return nil
+	}
+	if err = write(name, raw); err != nil {
+		return err
+	}
+	man := NewManifest()
+	man.AddVersion([]File{{
+		Name:         name,
+		OriginalName: orig,
+		Size:         int64(len(raw)),
+		Modified:     modified,
+		MIME:         "message/rfc822",
+		PUID:         ToPUID("fmt/278"), // Internet Message Format
+	}})
+	if len(atts) > 0 {
+		start := time.Now()
+		used := map[string]bool{strings.ToLower(name): true}
+		files := make([]File, len(atts))
+		for i, att := range atts {
+			aname := attachmentName(att, i, used)
+			if err = write(aname, att.data); err != nil {
+				return err
+			}
+			files[i] = File{
+				Name:     aname,
+				Size:     int64(len(att.data)),
+				Modified: modified,
+				MIME:     att.mime,
+				IsPartOf: FileTarget{0, 0}.String(),
+			}
+		}
+		man.AddVersion(files)
+		man.Versions[1].DerivedFrom = ReferenceVersion(0)
+		man.Versions[1].GeneratedBy = m.logEvent(dir, UnpackingEvent, start, time.Now(), "Extracted "+strconv.Itoa(len(atts))+" attachments from the message")
+	}
+	m.Index = append(m.Index, dir)
+	m.Metadata[dir] = met
+	m.Manifest[dir] = man
+	return nil
+}
+
+// mailAgents returns Agents for the addresses in the given headers
+func mailAgents(h mail.Header, keys ...string) Agent {
+	var agents Agent
+	for _, key := range keys {
+		addrs, err := h.AddressList(key)
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			name := addr.Name
+			if name == "" {
+				name = addr.Address
+			}
+			agents = AppendAgent(agents, MakeAgent(name, "mailto:"+addr.Address, ""))
+		}
+	}
+	return agents
+}
+
+// attachment is a file attached to an email message
+type attachment struct {
+	name string
+	mime string
+	data []byte
+}
+
+// attachments returns the attachments in a message body: parts with an attachment disposition or a file name.
+// Multipart bodies are searched recursively.
+func attachments(ctype, encoding, disposition string, body io.Reader) ([]attachment, error) {
+	mt, params, err := mime.ParseMediaType(ctype)
+	if err != nil {
+		mt = "text/plain" // the default content type for email
+	}
+	if strings.HasPrefix(mt, "multipart/") {
+		var ret []attachment
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				return ret, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			atts, err := attachments(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part.Header.Get("Content-Disposition"), part)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, atts...)
+		}
+	}
+	disp, dparams, _ := mime.ParseMediaType(disposition)
+	name := dparams["filename"]
+	if name == "" {
+		name = params["name"]
+	}
+	if disp != "attachment" && name == "" {
+		return nil, nil // part of the message body
+	}
+	if d, err := new(mime.WordDecoder).DecodeHeader(name); err == nil {
+		name = d
+	}
+	byt, err := ioutil.ReadAll(transferDecoder(encoding, body))
+	if err != nil {
+		return nil, err
+	}
+	return []attachment{{name, mt, byt}}, nil
+}
+
+// transferDecoder returns a reader that decodes a body with the given Content-Transfer-Encoding
+func transferDecoder(encoding string, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, body) // the decoder ignores line breaks
+	}
+	return body
+}
+
+// attachmentName returns a file name for an attachment that is safe to write and hasn't been used for another file of the message
+func attachmentName(att attachment, i int, used map[string]bool) string {
+	name := strings.TrimSpace(filepath.Base(strings.Replace(att.name, "\\", "/", -1)))
+	if name == "" || name == "." || name == ".." || name == "/" {
+		name = "attachment-" + strconv.Itoa(i+1)
+		if exts, _ := mime.ExtensionsByType(att.mime); len(exts) > 0 {
+			name += exts[0]
+		}
+	}
+	return uniqueName(name, used)
+}
+
+// mboxQuoted matches lines that were quoted to avoid being read as the start of a new message e.g. >From
+var mboxQuoted = regexp.MustCompile(`^>+From `)
+
+// readMbox reads an mbox archive and calls fn with each raw message in turn.
+// Each message starts with a "From " line, which is dropped, and quoted ">From " lines are unquoted.
+func readMbox(rdr *bufio.Reader, fn func(raw []byte) error) error {
+	var cur *bytes.Buffer
+	blank := true // messages start at the beginning of the file or after a blank line
+	for {
+		l, err := rdr.ReadBytes('\n')
+		switch {
+		case len(l) == 0:
+		case blank && bytes.HasPrefix(l, []byte("From ")):
+			if cur != nil {
+				if err := fn(trimNewline(cur.Bytes())); err != nil {
+					return err
+				}
+			}
+			cur, blank = new(bytes.Buffer), false
+		case cur != nil:
+			if mboxQuoted.Match(l) {
+				l = l[1:]
+			}
+			cur.Write(l)
+			blank = len(bytes.TrimRight(l, "\r\n")) == 0
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if cur != nil {
+		return fn(trimNewline(cur.Bytes()))
+	}
+	return nil
+}
+
+// trimNewline drops the blank line that separates a message from the next in an mbox archive
+func trimNewline(byt []byte) []byte {
+	if bytes.HasSuffix(byt, []byte("\r\n")) {
+		return byt[:len(byt)-2]
+	}
+	return bytes.TrimSuffix(byt, []byte("\n"))
+}
@@ -0,0 +1,117 @@
+// Copyright 2018 State of New South Wales through the State Archives and Records Authority of NSW
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package meta
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testMbox = "From richard@example.com Mon Apr 20 17:41:48 2015\n" +
+	"From: richard@example.com\n" +
+	"To: Archives <archives@example.com>, Jane Citizen <jane@example.com>\n" +
+	"Subject: First\n" +
+	"Message-ID: <1@example.com>\n" +
+	"\n" +
+	"Hello\n" +
+	">From the archives\n" +
+	"\n" +
+	"From jane@example.com Tue Apr 21 09:00:00 2015\n" +
+	"From: jane@example.com\n" +
+	"Subject: Second\n" +
+	"\n" +
+	"Goodbye\n"
+
+func TestEmailLoader(t *testing.T) {
+	src, err := ioutil.TempDir("", "meta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+	dir, err := ioutil.TempDir("", "meta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = ioutil.WriteFile(filepath.Join(src, "a.eml"), []byte(testEmail), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(src, "b.mbox"), []byte(testMbox), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	m, err := New(EmailLoader{Path: src, Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Index) != 3 {
+		t.Fatalf("Expecting 3 messages, got %v", m.Index)
+	}
+	// the eml file, with an attachment
+	idx := m.Index[0]
+	met, man := m.Metadata[idx], m.Manifest[idx]
+	if met.Title != "Café meeting" || met.Created == nil || met.Created.String() != "2015-04-20" {
+		t.Errorf("Unexpected metadata %+v", met)
+	}
+	if c, ok := met.Creator.(Obj); !ok || c.Name != "Richard Lehane" || c.ID != "mailto:richard@example.com" {
+		t.Errorf("Unexpected creator %v", met.Creator)
+	}
+	if len(man.Versions) != 2 || man.Versions[0].Files[0].Name != "a.eml" || man.Versions[1].DerivedFrom != "_:v0" {
+		t.Fatalf("Unexpected versions %v", man.Versions)
+	}
+	if f := man.Versions[1].Files[0]; f.Name != "notes.txt" || f.MIME != "text/plain" || f.Size != 5 || f.IsPartOf != "_:v0f0" {
+		t.Errorf("Unexpected attachment %v", f)
+	}
+	byt, err := ioutil.ReadFile(filepath.Join(FolderPath(m, idx), "notes.txt"))
+	if err != nil || string(byt) != "notes" {
+		t.Errorf("Expecting attachment to be written, got %q (%v)", byt, err)
+	}
+	// the mbox messages
+	met, man = m.Metadata[m.Index[1]], m.Manifest[m.Index[1]]
+	if met.Title != "First" || met.AgencyID != "mid:1@example.com" || met.IsPartOf != nil || len(man.Versions) != 1 {
+		t.Errorf("Unexpected metadata %+v", met)
+	}
+	if r, ok := met.Recipient.([]Agent); !ok || len(r) != 2 {
+		t.Errorf("Expecting two recipients, got %v", met.Recipient)
+	}
+	if f := man.Versions[0].Files[0]; f.Name != "b-1.eml" || f.OriginalName != filepath.Join(src, "b.mbox")+"#1" {
+		t.Errorf("Unexpected message file %v", f)
+	}
+	byt, err = ioutil.ReadFile(filepath.Join(FolderPath(m, m.Index[1]), "b-1.eml"))
+	if err != nil || string(byt[len(byt)-24:]) != "Hello\nFrom the archives\n" {
+		t.Errorf("Unexpected message %q (%v)", byt, err)
+	}
+	if m.Metadata[m.Index[2]].Title != "Second" {
+		t.Errorf("Unexpected second message %+v", m.Metadata[m.Index[2]])
+	}
+}
+
+func TestAttachmentName(t *testing.T) {
+	used := make(map[string]bool)
+	for i, tc := range []struct {
+		name, mime, expect string
+	}{
+		{"report.pdf", "application/pdf", "report.pdf"},
+		{"Report.PDF", "application/pdf", "Report (2).PDF"},
+		{"..\\..\\evil.exe", "", "evil.exe"},
+		{"..", "", "attachment-4"},
+		{".", "", "attachment-5"},
+	} {
+		if got := attachmentName(attachment{name: tc.name, mime: tc.mime}, i, used); got != tc.expect {
+			t.Errorf("attachmentName(%q): expecting %s, got %s", tc.name, tc.expect, got)
+		}
+	}
+}
@@ -0,0 +1,743 @@
+// Copyright 2018 State of New South Wales through the State Archives and Records Authority of NSW
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package meta
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// Embedded loader. Reads the metadata embedded in the files of each object and maps it onto the object's Metadata:
+// title, creator, created, modified and description. Embedded metadata is read from JPEG and TIFF files (EXIF),
+// PDFs (the document information dictionary), OOXML files (core properties) and OpenDocument files (meta.xml).
+//
+// The Path func returns the folder that holds an object's files, like the pathfunc given to ManifestCopy (e.g. IndexPath).
+// Files are read in the order they are listed in the first version of each object's manifest: for each field, the first embedded value found is used.
+//
+// By default, embedded values only fill fields that aren't already set. Titles that are just the name of an object's file
+// or folder (as set by the Siegfried and Directory loaders) count as not set. List fields in Overwrite (e.g. "title", "created")
+// for embedded values to take precedence over values already set. Use Embedded after the loaders whose values it should be weighed against.
+type Embedded struct {
+	Path      func(m *Meta, index string) string
+	Overwrite []string
+}
+
+// embeddedFields are the metadata fields that embedded metadata is mapped to
+var embeddedFields = map[string]bool{
+	"title":       true,
+	"creator":     true,
+	"created":     true,
+	"modified":    true,
+	"description": true,
+}
+
+func (e Embedded) Load(m *Meta) error {
+	overwrite := make(map[string]bool)
+	for _, fld := range e.Overwrite {
+		if !embeddedFields[fld] {
+			return fmt.Errorf("meta: embedded loader can't overwrite unknown metadata field %s", fld)
+		}
+		overwrite[fld] = true
+	}
+	for _, idx := range m.Index {
+		met, man := m.Metadata[idx], m.Manifest[idx]
+		if met == nil || man == nil || len(man.Versions) == 0 {
+			continue
+		}
+		var props Properties
+		for _, f := range man.Versions[0].Files {
+			p, err := ReadProperties(filepath.Join(e.Path(m, idx), filepath.FromSlash(f.Name)), f.MIME)
+			if err != nil {
+				if err = m.Fail(idx, "meta.Embedded", fmt.Errorf("meta: error reading embedded metadata from %s: %v", f.Name, err)); err != nil {
+					return err
+				}
+				continue
+			}
+			props.merge(p)
+		}
+		if props.Title != "" && (overwrite["title"] || met.Title == "" || met.Title == defaultTitle(idx)) {
+			met.Title = props.Title
+		}
+		if props.Creator != "" && (overwrite["creator"] || met.Creator == nil) {
+			met.Creator = MakeAgent(props.Creator, "", "")
+		}
+		if props.Created != nil && (overwrite["created"] || met.Created == nil) {
+			met.Created = props.Created
+		}
+		if props.Modified != nil && (overwrite["modified"] || met.Modified == nil) {
+			met.Modified = props.Modified
+		}
+		if props.Description != "" && (overwrite["description"] || met.Description == "") {
+			met.Description = props.Description
+		}
+	}
+	return nil
+}
+
+// defaultTitle is the title given to an object by loaders that name objects after their file or folder
+func defaultTitle(index string) string {
+	base := filepath.Base(index)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// Properties is the metadata embedded in a file
+type Properties struct {
+	Title       string
+	Creator     string
+	Description string
+	Created     *W3CDate
+	Modified    *W3CDate
+}
+
+// merge fills p's empty fields with the values in q
+func (p *Properties) merge(q Properties) {
+	if p.Title == "" {
+		p.Title = q.Title
+	}
+	if p.Creator == "" {
+		p.Creator = q.Creator
+	}
+	if p.Description == "" {
+		p.Description = q.Description
+	}
+	if p.Created == nil {
+		p.Created = q.Created
+	}
+	if p.Modified == nil {
+		p.Modified = q.Modified
+	}
+}
+
+// ReadProperties reads the metadata embedded in the file at path. The kind of file is determined by its MIME type or,
+// if that is empty, its extension. Files that don't have embedded metadata that can be read return empty Properties.
+// Only the parts of a file that hold its metadata are read.
+func ReadProperties(path, mimeType string) (Properties, error) {
+	mt, _, _ := mime.ParseMediaType(mimeType)
+	if mt == "" {
+		mt = mime.TypeByExtension(strings.ToLower(filepath.Ext(path)))
+		mt, _, _ = mime.ParseMediaType(mt)
+	}
+	var read func(r io.ReaderAt, size int64) (Properties, error)
+	switch {
+	case mt == "image/jpeg", mt == "image/tiff":
+		read = exifProperties
+	case mt == "application/pdf":
+		read = pdfProperties
+	case strings.HasPrefix(mt, "application/vnd.openxmlformats-officedocument."):
+		read = zipProperties("docProps/core.xml")
+	case strings.HasPrefix(mt, "application/vnd.oasis.opendocument."):
+		read = zipProperties("meta.xml")
+	}
+	if read == nil {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".docx", ".xlsx", ".pptx":
+			read = zipProperties("docProps/core.xml")
+		case ".odt", ".ods", ".odp":
+			read = zipProperties("meta.xml")
+		default:
+			return Properties{}, nil
+		}
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return Properties{}, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return Properties{}, err
+	}
+	return read(f, fi.Size())
+}
+
+// readAt reads up to n bytes from r at offset off. Fewer bytes are returned if the end of r is reached.
+func readAt(r io.ReaderAt, off, n int64) ([]byte, error) {
+	byt := make([]byte, n)
+	l, err := r.ReadAt(byt, off)
+	if err == io.EOF {
+		err = nil
+	}
+	return byt[:l], err
+}
+
+var errEXIF = errors.New("malformed EXIF")
+
+// EXIF tags mapped to Properties
+const (
+	exifImageDescription  = 0x010E
+	exifDateTime          = 0x0132
+	exifArtist            = 0x013B
+	exifIFD               = 0x8769
+	exifDateTimeOriginal  = 0x9003
+	exifDateTimeDigitized = 0x9004
+	exifXPTitle           = 0x9C9B
+	exifXPComment         = 0x9C9C
+	exifXPAuthor          = 0x9C9D
+)
+
+// exifTags are the tags that are read from EXIF IFDs: the values of other tags (e.g. image data offsets) are skipped
+var exifTags = map[uint16]bool{
+	exifImageDescription:  true,
+	exifDateTime:          true,
+	exifArtist:            true,
+	exifIFD:               true,
+	exifDateTimeOriginal:  true,
+	exifDateTimeDigitized: true,
+	exifXPTitle:           true,
+	exifXPComment:         true,
+	exifXPAuthor:          true,
+}
+
+// maxEXIFValue is the largest EXIF value that is read
+const maxEXIFValue = 64 * 1024
+
+// exifProperties reads the EXIF metadata in a JPEG or TIFF file
+func exifProperties(r io.ReaderAt, size int64) (Properties, error) {
+	var props Properties
+	head, err := readAt(r, 0, 2)
+	if err != nil {
+		return props, err
+	}
+	tiff := io.NewSectionReader(r, 0, size)
+	if bytes.Equal(head, []byte{0xFF, 0xD8}) {
+		// find the APP1 segment with the EXIF data
+		tiff = nil
+		for off := int64(2); ; {
+			seg, err := readAt(r, off, 10)
+			if err != nil {
+				return props, err
+			}
+			if len(seg) < 4 || seg[0] != 0xFF {
+				break
+			}
+			marker, l := seg[1], int64(binary.BigEndian.Uint16(seg[2:]))
+			if marker == 0xDA || marker == 0xD9 || off+2+l > size {
+				break
+			}
+			if marker == 0xE1 && bytes.HasPrefix(seg[4:], []byte("Exif\x00\x00")) && l >= 8 {
+				tiff = io.NewSectionReader(r, off+10, l-8)
+				break
+			}
+			off += 2 + l
+		}
+		if tiff == nil {
+			return props, nil
+		}
+	}
+	hdr, err := readAt(tiff, 0, 8)
+	if err != nil {
+		return props, err
+	}
+	if len(hdr) < 8 {
+		return props, errEXIF
+	}
+	var order binary.ByteOrder
+	switch string(hdr[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return props, errEXIF
+	}
+	ifd0, err := readIFD(tiff, order, order.Uint32(hdr[4:]))
+	if err != nil {
+		return props, err
+	}
+	tags := ifd0
+	if v, ok := ifd0[exifIFD]; ok && len(v) == 4 {
+		sub, err := readIFD(tiff, order, order.Uint32(v))
+		if err != nil {
+			return props, err
+		}
+		for k, v := range sub {
+			tags[k] = v
+		}
+	}
+	ascii := func(tag uint16) string {
+		v := tags[tag]
+		if idx := bytes.IndexByte(v, 0); idx >= 0 {
+			v = v[:idx]
+		}
+		return strings.TrimSpace(string(v))
+	}
+	xp := func(tag uint16) string {
+		v := tags[tag]
+		u := make([]uint16, 0, len(v)/2)
+		for i := 0; i+1 < len(v); i += 2 {
+			if c := binary.LittleEndian.Uint16(v[i:]); c != 0 {
+				u = append(u, c)
+			}
+		}
+		return strings.TrimSpace(string(utf16.Decode(u)))
+	}
+	date := func(tags ...uint16) *W3CDate {
+		for _, tag := range tags {
+			if t, err := time.Parse("2006:01:02 15:04:05", ascii(tag)); err == nil {
+				return WrapDate(t)
+			}
+		}
+		return nil
+	}
+	props.Title = xp(exifXPTitle)
+	props.Creator = firstOf(ascii(exifArtist), xp(exifXPAuthor))
+	props.Description = firstOf(ascii(exifImageDescription), xp(exifXPComment))
+	props.Created = date(exifDateTimeOriginal, exifDateTimeDigitized)
+	props.Modified = date(exifDateTime)
+	return props, nil
+}
+
+// readIFD reads the entries in the TIFF image file directory at offset off and returns the values of the exifTags
+func readIFD(tiff *io.SectionReader, order binary.ByteOrder, off uint32) (map[uint16][]byte, error) {
+	size := tiff.Size()
+	cnt, err := readAt(tiff, int64(off), 2)
+	if err != nil {
+		return nil, err
+	}
+	if len(cnt) < 2 {
+		return nil, errEXIF
+	}
+	n := int(order.Uint16(cnt))
+	entries, err := readAt(tiff, int64(off)+2, int64(n)*12)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) < n*12 {
+		return nil, errEXIF
+	}
+	sizes := map[uint16]int64{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8}
+	ret := make(map[uint16][]byte)
+	for i := 0; i < n; i++ {
+		entry := entries[i*12:]
+		tag, typ, count := order.Uint16(entry), order.Uint16(entry[2:]), int64(order.Uint32(entry[4:]))
+		sz, ok := sizes[typ]
+		if !ok || !exifTags[tag] {
+			continue
+		}
+		l := sz * count
+		if l <= 4 {
+			ret[tag] = entry[8 : 8+l]
+			continue
+		}
+		voff := int64(order.Uint32(entry[8:]))
+		if voff+l > size {
+			return nil, errEXIF
+		}
+		if l > maxEXIFValue {
+			continue
+		}
+		if ret[tag], err = readAt(tiff, voff, l); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+var (
+	pdfInfoRef    = regexp.MustCompile(`/Info\s+(\d+)\s+(\d+)\s+R`)
+	pdfStartXref  = regexp.MustCompile(`startxref\s+(\d+)`)
+	pdfSubsection = regexp.MustCompile(`^\s*(\d+)\s+(\d+)[ \t]*\r?\n`)
+	pdfPrev       = regexp.MustCompile(`/Prev\s+(\d+)`)
+	errPDF        = errors.New("malformed document information dictionary")
+)
+
+// pdfWindow is the most that is read from a PDF at a time (e.g. the end of the file, which holds the trailer, or an object)
+const pdfWindow = 64 * 1024
+
+// pdfProperties reads the document information dictionary in a PDF.
+// The dictionary is found using the cross-reference table or, if the table can't be used (e.g. it is compressed),
+// by scanning the file for it. The dictionary isn't found if it is stored within a compressed object stream.
+func pdfProperties(r io.ReaderAt, size int64) (Properties, error) {
+	var props Properties
+	start := size - pdfWindow
+	if start < 0 {
+		start = 0
+	}
+	tail, err := readAt(r, start, pdfWindow)
+	if err != nil {
+		return props, err
+	}
+	refs := pdfInfoRef.FindAllSubmatch(tail, -1)
+	if len(refs) == 0 {
+		return props, nil
+	}
+	ref := refs[len(refs)-1] // the last trailer is the most recent update
+	obj := regexp.MustCompile(`(?:^|[^0-9])` + string(ref[1]) + `\s+` + string(ref[2]) + `\s+obj\s*<<`)
+	var byt []byte
+	if xrefs := pdfStartXref.FindAllSubmatch(tail, -1); len(xrefs) > 0 {
+		num, _ := strconv.Atoi(string(ref[1]))
+		xref, _ := strconv.ParseInt(string(xrefs[len(xrefs)-1][1]), 10, 64)
+		if off := pdfXref(r, xref, num); off >= 0 {
+			if byt, err = readAt(r, off, pdfWindow); err != nil {
+				return props, err
+			}
+			if loc := obj.FindIndex(byt); loc != nil && loc[0] == 0 {
+				byt = byt[loc[1]:]
+			} else {
+				byt = nil
+			}
+		}
+	}
+	if byt == nil {
+		off, err := pdfScan(r, size, obj)
+		if err != nil || off < 0 {
+			return props, err
+		}
+		if byt, err = readAt(r, off, pdfWindow); err != nil {
+			return props, err
+		}
+	}
+	info, err := pdfDict(byt)
+	if err != nil {
+		return props, err
+	}
+	props.Title = info["Title"]
+	props.Creator = info["Author"]
+	props.Description = info["Subject"]
+	props.Created = pdfDate(info["CreationDate"])
+	props.Modified = pdfDate(info["ModDate"])
+	return props, nil
+}
+
+// pdfXref looks up the offset of object num in the cross-reference table at offset xref, and in any earlier tables
+// that it links to. Returns -1 if the object isn't found or the table isn't a plain cross-reference table.
+func pdfXref(r io.ReaderAt, xref int64, num int) int64 {
+	for i := 0; i < 100 && xref >= 0; i++ { // bound the number of tables followed in case they loop
+		byt, err := readAt(r, xref, 4)
+		if err != nil || string(byt) != "xref" {
+			return -1
+		}
+		pos := xref + 4
+		for {
+			hdr, err := readAt(r, pos, 64)
+			if err != nil {
+				return -1
+			}
+			sub := pdfSubsection.FindSubmatch(hdr)
+			if sub == nil {
+				break // the trailer
+			}
+			first, _ := strconv.Atoi(string(sub[1]))
+			count, _ := strconv.Atoi(string(sub[2]))
+			pos += int64(len(sub[0]))
+			if num >= first && num < first+count {
+				// each entry is 20 bytes: a 10 digit offset, a 5 digit generation and n (in use) or f (free)
+				entry, err := readAt(r, pos+int64(num-first)*20, 20)
+				if err != nil || len(entry) < 18 || entry[17] != 'n' {
+					return -1
+				}
+				off, err := strconv.ParseInt(string(entry[:10]), 10, 64)
+				if err != nil {
+					return -1
+				}
+				return off
+			}
+			pos += int64(count) * 20
+		}
+		trailer, err := readAt(r, pos, pdfWindow)
+		if err != nil {
+			return -1
+		}
+		if end := bytes.Index(trailer, []byte("startxref")); end >= 0 {
+			trailer = trailer[:end]
+		}
+		prev := pdfPrev.FindSubmatch(trailer)
+		if prev == nil {
+			return -1
+		}
+		xref, _ = strconv.ParseInt(string(prev[1]), 10, 64)
+	}
+	return -1
+}
+
+// pdfScan reads a PDF a window at a time looking for the last match of an object's opening. Returns the offset of the end
+// of the match, or -1 if there is no match.
+func pdfScan(r io.ReaderAt, size int64, obj *regexp.Regexp) (int64, error) {
+	const overlap = 64 // so that matches that straddle windows are found
+	last := int64(-1)
+	for off := int64(0); off < size; off += pdfWindow - overlap {
+		byt, err := readAt(r, off, pdfWindow)
+		if err != nil {
+			return -1, err
+		}
+		for _, loc := range obj.FindAllIndex(byt, -1) {
+			// a match at the start of a later window might be the end of a longer object number, and any real
+			// match there was found in the previous window's overlap
+			if loc[0] == 0 && off > 0 {
+				continue
+			}
+			last = off + int64(loc[1])
+		}
+	}
+	return last, nil
+}
+
+// pdfDict returns the string values in a PDF dictionary. The input starts after the dictionary's opening <<.
+func pdfDict(byt []byte) (map[string]string, error) {
+	ret := make(map[string]string)
+	var key string
+	depth := 0
+	for i := 0; i < len(byt); {
+		switch c := byt[i]; {
+		case c == '/':
+			j := i + 1
+			for j < len(byt) && !bytes.ContainsRune([]byte(" \t\r\n/<>[]()"), rune(byt[j])) {
+				j++
+			}
+			if depth == 0 {
+				key = string(byt[i+1 : j])
+			}
+			i = j
+		case c == '(':
+			s, n := pdfLiteral(byt[i:])
+			if n == 0 {
+				return nil, errPDF
+			}
+			if depth == 0 && key != "" {
+				ret[key] = pdfText(s)
+			}
+			key = ""
+			i += n
+		case c == '<' && i+1 < len(byt) && byt[i+1] == '<':
+			depth++
+			i += 2
+		case c == '>' && i+1 < len(byt) && byt[i+1] == '>':
+			if depth == 0 {
+				return ret, nil
+			}
+			depth--
+			i += 2
+		case c == '<':
+			end := bytes.IndexByte(byt[i:], '>')
+			if end < 0 {
+				return nil, errPDF
+			}
+			digits := strings.Join(strings.Fields(string(byt[i+1:i+end])), "")
+			if len(digits)%2 == 1 {
+				digits += "0"
+			}
+			s, err := hex.DecodeString(digits)
+			if err != nil {
+				return nil, errPDF
+			}
+			if depth == 0 && key != "" {
+				ret[key] = pdfText(s)
+			}
+			key = ""
+			i += end + 1
+		default:
+			i++
+		}
+	}
+	return nil, errPDF
+}
+
+// pdfLiteral reads a PDF literal string (in parentheses) and returns its bytes and the number of input bytes read.
+// Returns 0 if the string isn't closed.
+func pdfLiteral(byt []byte) ([]byte, int) {
+	var buf bytes.Buffer
+	depth := 0
+	for i := 0; i < len(byt); i++ {
+		switch c := byt[i]; c {
+		case '(':
+			if depth > 0 {
+				buf.WriteByte(c)
+			}
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return buf.Bytes(), i + 1
+			}
+			buf.WriteByte(c)
+		case '\\':
+			i++
+			if i >= len(byt) {
+				return nil, 0
+			}
+			switch e := byt[i]; e {
+			case 'n':
+				buf.WriteByte('\n')
+			case 'r':
+				buf.WriteByte('\r')
+			case 't':
+				buf.WriteByte('\t')
+			case 'b':
+				buf.WriteByte('\b')
+			case 'f':
+				buf.WriteByte('\f')
+			case '\r':
+				if i+1 < len(byt) && byt[i+1] == '\n' {
+					i++
+				}
+			case '\n':
+			default:
+				if e >= '0' && e <= '7' {
+					var o byte
+					for j := 0; j < 3 && i < len(byt) && byt[i] >= '0' && byt[i] <= '7'; j++ {
+						o = o*8 + byt[i] - '0'
+						i++
+					}
+					i--
+					buf.WriteByte(o)
+					continue
+				}
+				buf.WriteByte(e)
+			}
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	return nil, 0
+}
+
+// pdfText decodes a PDF text string, which is either UTF-16BE (with a byte order mark) or PDFDocEncoding.
+// PDFDocEncoding is treated as Latin-1, which it matches for printable characters.
+func pdfText(byt []byte) string {
+	if bytes.HasPrefix(byt, []byte{0xFE, 0xFF}) {
+		u := make([]uint16, 0, len(byt)/2)
+		for i := 2; i+1 < len(byt); i += 2 {
+			u = append(u, binary.BigEndian.Uint16(byt[i:]))
+		}
+		return strings.TrimSpace(string(utf16.Decode(u)))
+	}
+	r := make([]rune, len(byt))
+	for i, b := range byt {
+		r[i] = rune(b)
+	}
+	return strings.TrimSpace(string(r))
+}
+
+// pdfDate parses a PDF date e.g. D:20150420174148+10'00'. Returns nil if the date can't be parsed.
+func pdfDate(d string) *W3CDate {
+	d = strings.TrimPrefix(d, "D:")
+	n := 0
+	for n < len(d) && n < 14 && d[n] >= '0' && d[n] <= '9' {
+		n++
+	}
+	var precision int
+	switch {
+	case n == 4:
+		precision = 2
+	case n == 6:
+		precision = 1
+	case n < 8:
+		return nil
+	}
+	digits := d[:n] + "0101000000"[n-4:]
+	loc := time.UTC
+	if zone := strings.Replace(d[n:], "'", "", -1); len(zone) >= 3 && (zone[0] == '+' || zone[0] == '-') {
+		if z, err := time.Parse("-0700", (zone + "00")[:5]); err == nil {
+			loc = z.Location()
+		}
+	}
+	t, err := time.ParseInLocation("20060102150405", digits, loc)
+	if err != nil {
+		return nil
+	}
+	return &W3CDate{precision, t}
+}
+
+// zipProperties returns a func that reads the core properties of an OOXML file (docProps/core.xml) or the metadata
+// of an OpenDocument file (meta.xml) from the named part
+func zipProperties(part string) func(r io.ReaderAt, size int64) (Properties, error) {
+	return func(r io.ReaderAt, size int64) (Properties, error) {
+		var props Properties
+		rdr, err := zip.NewReader(r, size)
+		if err != nil {
+			return props, err
+		}
+		for _, f := range rdr.File {
+			if f.Name != part {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return props, err
+			}
+			defer rc.Close()
+			return xmlProperties(rc)
+		}
+		return props, nil
+	}
+}
+
+// xmlProperties reads Dublin Core and OpenDocument meta elements from OOXML core properties or OpenDocument meta.xml
+func xmlProperties(rdr io.Reader) (Properties, error) {
+	var props Properties
+	vals := make(map[string]string)
+	dec := xml.NewDecoder(rdr)
+	var el string
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return props, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			el = t.Name.Local
+		case xml.EndElement:
+			el = ""
+		case xml.CharData:
+			if el != "" {
+				vals[el] += string(t)
+			}
+		}
+	}
+	date := func(names ...string) *W3CDate {
+		for _, name := range names {
+			v := strings.TrimSpace(vals[name])
+			for _, layout := range []string{"2006-01-02T15:04:05.999999999Z07:00", "2006-01-02T15:04:05.999999999", "2006-01-02"} {
+				if t, err := time.Parse(layout, v); err == nil {
+					return WrapDate(t)
+				}
+			}
+		}
+		return nil
+	}
+	props.Title = strings.TrimSpace(vals["title"])
+	props.Creator = firstOf(strings.TrimSpace(vals["initial-creator"]), strings.TrimSpace(vals["creator"]))
+	props.Description = strings.TrimSpace(vals["description"])
+	props.Created = date("created", "creation-date")
+	props.Modified = date("modified", "date")
+	return props, nil
+}
+
+// firstOf returns the first non-empty string
+func firstOf(strs ...string) string {
+	for _, s := range strs {
+		if s != "" {
+			return s
+		}
+	}
+	return ""
+}
@@ -0,0 +1,182 @@
+// Copyright 2018 State of New South Wales through the State Archives and Records Authority of NSW
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package meta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testEXIF returns a JPEG with an EXIF segment that has Artist and ImageDescription tags and a DateTimeOriginal tag in an EXIF IFD
+func testEXIF(t *testing.T) []byte {
+	var tiff bytes.Buffer
+	le := binary.LittleEndian
+	artist, desc, date := "Richard Lehane\x00", "Teddy bears\x00", "2015:04:20 17:41:48\x00"
+	// header (8) + IFD0 with 3 entries (2 + 36 + 4) + EXIF IFD with 1 entry (2 + 12 + 4) = 68, then the values
+	values := uint32(68)
+	tiff.WriteString("II")
+	binary.Write(&tiff, le, uint16(42))
+	binary.Write(&tiff, le, uint32(8))
+	entry := func(tag, typ uint16, count, val uint32) {
+		binary.Write(&tiff, le, tag)
+		binary.Write(&tiff, le, typ)
+		binary.Write(&tiff, le, count)
+		binary.Write(&tiff, le, val)
+	}
+	binary.Write(&tiff, le, uint16(3))
+	entry(exifImageDescription, 2, uint32(len(desc)), values)
+	entry(exifArtist, 2, uint32(len(artist)), values+uint32(len(desc)))
+	entry(exifIFD, 4, 1, 50)
+	binary.Write(&tiff, le, uint32(0))
+	binary.Write(&tiff, le, uint16(1))
+	entry(exifDateTimeOriginal, 2, uint32(len(date)), values+uint32(len(desc)+len(artist)))
+	binary.Write(&tiff, le, uint32(0))
+	tiff.WriteString(desc + artist + date)
+	var img bytes.Buffer
+	if err := jpeg.Encode(&img, image.NewGray(image.Rect(0, 0, 8, 8)), nil); err != nil {
+		t.Fatal(err)
+	}
+	var ret bytes.Buffer
+	ret.Write([]byte{0xFF, 0xD8, 0xFF, 0xE1})
+	binary.Write(&ret, binary.BigEndian, uint16(tiff.Len()+8))
+	ret.WriteString("Exif\x00\x00")
+	ret.Write(tiff.Bytes())
+	ret.Write(img.Bytes()[2:])
+	return ret.Bytes()
+}
+
+const testPDF = "%PDF-1.4\n" +
+	"1 0 obj\n<< /Type /Catalog >>\nendobj\n" +
+	"2 0 obj\n<< /Title (Annual \\(draft\\) report) /Author <FEFF005200690063006B> /CreationDate (D:20150420174148+10'00') /Producer (Writer) >>\nendobj\n" +
+	"trailer\n<< /Root 1 0 R /Info 2 0 R >>\n%%EOF\n"
+
+func TestReadProperties(t *testing.T) {
+	dir, err := ioutil.TempDir("", "meta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	jpg, pdf, docx := filepath.Join(dir, "a.jpg"), filepath.Join(dir, "b.pdf"), filepath.Join(dir, "c.docx")
+	if err = ioutil.WriteFile(jpg, testEXIF(t), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(pdf, []byte(testPDF), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	writeZip(t, docx, map[string]string{
+		"docProps/core.xml": `<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:dcterms="http://purl.org/dc/terms/">` +
+			`<dc:title>Minutes</dc:title><dc:creator>Jane Citizen</dc:creator><dcterms:created>2015-04-20T07:41:48Z</dcterms:created><dcterms:modified>2015-05-01T00:00:00Z</dcterms:modified></cp:coreProperties>`,
+	})
+	p, err := ReadProperties(jpg, "image/jpeg")
+	if err != nil || p.Creator != "Richard Lehane" || p.Description != "Teddy bears" || p.Created == nil || p.Created.String() != "2015-04-20" {
+		t.Errorf("Unexpected EXIF properties %+v (%v)", p, err)
+	}
+	p, err = ReadProperties(pdf, "application/pdf")
+	if err != nil || p.Title != "Annual (draft) report" || p.Creator != "Rick" || p.Created == nil || p.Created.String() != "2015-04-20" {
+		t.Errorf("Unexpected PDF properties %+v (%v)", p, err)
+	}
+	p, err = ReadProperties(docx, "")
+	if err != nil || p.Title != "Minutes" || p.Creator != "Jane Citizen" || p.Modified == nil || p.Modified.String() != "2015-05-01" {
+		t.Errorf("Unexpected OOXML properties %+v (%v)", p, err)
+	}
+}
+
+// testXrefPDF returns a PDF with an incremental update, so its information dictionary is found through the previous
+// cross-reference table. A decoy object with the same number is in a content stream, which a scan of the file would find.
+func testXrefPDF() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	var offs []int
+	obj := func(s string) {
+		offs = append(offs, buf.Len())
+		buf.WriteString(s)
+	}
+	obj("1 0 obj\n<< /Type /Catalog >>\nendobj\n")
+	obj("2 0 obj\n<< /Title (Annual report) /Author (Jane Citizen) >>\nendobj\n")
+	content := strings.Repeat("x", 2*pdfWindow) + "\n2 0 obj\n<< /Title (Decoy) >>\n"
+	obj(fmt.Sprintf("3 0 obj\n<< /Length %d >>\nstream\n%s\nendstream\nendobj\n", len(content), content))
+	xref := buf.Len()
+	buf.WriteString("xref\n0 4\n0000000000 65535 f \n")
+	for _, off := range offs {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size 4 /Root 1 0 R /Info 2 0 R >>\nstartxref\n%d\n%%%%EOF\n", xref)
+	// update the catalog
+	update := buf.Len()
+	buf.WriteString("1 0 obj\n<< /Type /Catalog /Lang (en) >>\nendobj\n")
+	xref2 := buf.Len()
+	fmt.Fprintf(&buf, "xref\n1 1\n%010d 00000 n \ntrailer\n<< /Size 4 /Root 1 0 R /Info 2 0 R /Prev %d >>\nstartxref\n%d\n%%%%EOF\n", update, xref, xref2)
+	return buf.Bytes()
+}
+
+func TestPDFXref(t *testing.T) {
+	pdf := testXrefPDF()
+	p, err := pdfProperties(bytes.NewReader(pdf), int64(len(pdf)))
+	if err != nil || p.Title != "Annual report" || p.Creator != "Jane Citizen" {
+		t.Errorf("Expecting properties from the object in the cross-reference table, got %+v (%v)", p, err)
+	}
+	// without the cross-reference table, the last object in the file is used
+	p, err = pdfProperties(bytes.NewReader([]byte(testPDF)), int64(len(testPDF)))
+	if err != nil || p.Title != "Annual (draft) report" {
+		t.Errorf("Expecting properties found by scanning, got %+v (%v)", p, err)
+	}
+}
+
+func TestTIFFProperties(t *testing.T) {
+	jpg := testEXIF(t)
+	tiff := jpg[12 : 4+int(binary.BigEndian.Uint16(jpg[4:]))]
+	p, err := exifProperties(bytes.NewReader(tiff), int64(len(tiff)))
+	if err != nil || p.Creator != "Richard Lehane" || p.Description != "Teddy bears" || p.Created == nil || p.Created.String() != "2015-04-20" {
+		t.Errorf("Unexpected TIFF properties %+v (%v)", p, err)
+	}
+}
+
+func TestEmbedded(t *testing.T) {
+	dir, err := ioutil.TempDir("", "meta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pdf := filepath.Join(dir, "b.pdf")
+	if err = ioutil.WriteFile(pdf, []byte(testPDF), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	load := func(overwrite ...string) *Metadata {
+		m, _ := New()
+		met, man := NewMetadata(0, "b"), NewManifest()
+		met.Created = WrapDate(*NewDateTime("2016-01-01T00:00:00Z"))
+		man.AddVersion([]File{{Name: "b.pdf", MIME: "application/pdf"}})
+		m.Index, m.Metadata[pdf], m.Manifest[pdf] = []string{pdf}, met, man
+		if err := (Embedded{Path: IndexPath, Overwrite: overwrite}).Load(m); err != nil {
+			t.Fatal(err)
+		}
+		return met
+	}
+	met := load()
+	if met.Title != "Annual (draft) report" || met.Creator != "Rick" || met.Created.String() != "2016-01-01" {
+		t.Errorf("Expecting embedded values to fill unset fields only, got %+v", met)
+	}
+	if met = load("created"); met.Created.String() != "2015-04-20" {
+		t.Errorf("Expecting embedded created date to take precedence, got %v", met.Created)
+	}
+}
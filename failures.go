@@ -0,0 +1,147 @@
+// Copyright 2018 State of New South Wales through the State Archives and Records Authority of NSW
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package meta
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// ReportFile is the name of the error report written to the target directory by Output and OutputConcurrent
+// when a Meta's CollectErrors field is set and failures have occurred
+const ReportFile = "errors.csv"
+
+// Failure records an error that affected a single index.
+// The Action field names the action or loader that failed.
+// Failures during loading that don't relate to a particular index have an empty Index.
+type Failure struct {
+	Index  string
+	Action string
+	Err    error
+}
+
+func (f Failure) Error() string {
+	if f.Index == "" {
+		return fmt.Sprintf("%s: %v", f.Action, f.Err)
+	}
+	return fmt.Sprintf("%s (%s): %v", f.Index, f.Action, f.Err)
+}
+
+// Failures is the aggregated error returned by New, Output and OutputConcurrent when a Meta's CollectErrors field is set
+type Failures []Failure
+
+func (fs Failures) Error() string {
+	msgs := make([]string, len(fs))
+	for i, f := range fs {
+		msgs[i] = f.Error()
+	}
+	return fmt.Sprintf("meta: %d failures\n%s", len(fs), strings.Join(msgs, "\n"))
+}
+
+// WriteReport writes the failures as a CSV file with index, action and error columns
+func (fs Failures) WriteReport(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	w.Write([]string{"index", "action", "error"})
+	for _, fail := range fs {
+		w.Write([]string{fail.Index, fail.Action, fail.Err.Error()})
+	}
+	w.Flush()
+	if err = w.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Fail handles an error that affects a single index. The name identifies the action or loader that failed.
+// If the Meta's CollectErrors field is set, the failure is recorded and nil is returned so that processing can continue.
+// Otherwise the error is returned unchanged.
+// Loaders should call Fail for errors that only affect a single object.
+func (m *Meta) Fail(index, name string, err error) error {
+	if err == nil || !m.CollectErrors {
+		return err
+	}
+	m.mu.Lock()
+	m.failures = append(m.failures, Failure{index, name, err})
+	m.mu.Unlock()
+	return nil
+}
+
+// Failed returns the failures recorded so far
+func (m *Meta) Failed() Failures {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.failures) == 0 {
+		return nil
+	}
+	ret := make(Failures, len(m.failures))
+	copy(ret, m.failures)
+	return ret
+}
+
+// actionName returns a name for an Action based on the name of the function that created it e.g. meta.ManifestCopy
+func actionName(a Action) string {
+	fn := runtime.FuncForPC(reflect.ValueOf(a).Pointer())
+	if fn == nil {
+		return "action"
+	}
+	name := path.Base(fn.Name())
+	// trim the suffixes given to closures e.g. .func1 or .func1.2
+	for {
+		idx := strings.LastIndex(name, ".")
+		if idx < 0 {
+			break
+		}
+		suffix := name[idx+1:]
+		if _, err := strconv.Atoi(strings.TrimPrefix(suffix, "func")); err != nil {
+			break
+		}
+		name = name[:idx]
+	}
+	return name
+}
+
+// actionError is returned by actions that wrap another action (e.g. Serial) so that failures are reported with the name of the wrapped action
+type actionError struct {
+	name string
+	err  error
+}
+
+func (e actionError) Error() string {
+	return e.err.Error()
+}
+
+// failedAction returns the name of the action that returned an error and the underlying error
+func failedAction(a Action, err error) (string, error) {
+	if ae, ok := err.(actionError); ok {
+		return ae.name, ae.err
+	}
+	return actionName(a), err
+}
+
+// loaderName returns a name for a Loader based on its type e.g. meta.Siegfried
+func loaderName(l Loader) string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", l), "*")
+}
@@ -0,0 +1,99 @@
+// Copyright 2018 State of New South Wales through the State Archives and Records Authority of NSW
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package meta
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCollectErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "meta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	m := testMeta(10)
+	m.CollectErrors = true
+	corrupt := errors.New("corrupt file")
+	err = m.Output(dir, func(m *Meta, target, index string) error {
+		if index == "object3" || index == "object7" {
+			return corrupt
+		}
+		return nil
+	})
+	fs, ok := err.(Failures)
+	if !ok {
+		t.Fatalf("Expecting Failures error, got %v", err)
+	}
+	if len(fs) != 2 || fs[0].Index != "object3" || fs[1].Err != corrupt || fs[1].Action != "meta.TestCollectErrors" {
+		t.Errorf("Expecting failures for object3 and object7, got %v", fs)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "9", "metadata.json")); err != nil {
+		t.Errorf("Expecting processing to continue after failures, got %v", err)
+	}
+	rows, err := ReadAll(filepath.Join(dir, ReportFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Errorf("Expecting a report with a header and 2 rows, got %v", rows)
+	}
+}
+
+func TestCollectLoaders(t *testing.T) {
+	dir, err := ioutil.TempDir("", "meta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = testMeta(3).Output(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, "1", "metadata.json"), []byte("{bad json"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = New(SIPDir(dir)); err == nil {
+		t.Fatal("Expecting an error loading a corrupt SIP")
+	}
+	m, err := NewCollect(SIPDir(dir))
+	fs, ok := err.(Failures)
+	if !ok || len(fs) != 1 || fs[0].Index != filepath.Join(dir, "1") {
+		t.Fatalf("Expecting a single failure for SIP 1, got %v", err)
+	}
+	if len(m.Index) != 2 {
+		t.Errorf("Expecting the other SIPs to load, got %v", m.Index)
+	}
+}
+
+func TestActionName(t *testing.T) {
+	if name := actionName(ManifestCopy(IndexPath)); name != "meta.ManifestCopy" {
+		t.Errorf("Expecting meta.ManifestCopy, got %s", name)
+	}
+	bad := errors.New("bad")
+	a := Serial(Serial(failing(bad)))
+	if name, err := failedAction(a, a(nil, "", "")); name != "meta.failing" || err != bad {
+		t.Errorf("Expecting meta.failing to be named for a serial action, got %s (%v)", name, err)
+	}
+}
+
+func failing(err error) Action {
+	return func(m *Meta, target, index string) error {
+		return err
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright 2018 State of New South Wales through the State Archives and Records Authority of NSW
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package meta
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ExclusionsFile is a suggested name for an exclusions report written with Exclusions.WriteReport
+const ExclusionsFile = "exclusions.csv"
+
+// Predicate is a custom test for a Filter. It is given a file's path, size and format ID (which may be empty if
+// the loader doesn't identify files) and returns a reason for excluding the file, or an empty string to keep it.
+type Predicate func(path string, size int64, format string) string
+
+// Filter excludes files from loading. Loaders that take a Filter (e.g. Siegfried and Directory) call Exclude for each
+// file they encounter and skip the file if it returns true. A nil Filter excludes nothing.
+//
+// Files are excluded if:
+//   - their format ID (e.g. fmt/19, as reported by siegfried) is listed in Formats;
+//   - their file name, or the name of any folder in their path, matches one of the Names globs (see filepath.Match) e.g. "~$*" or "__MACOSX";
+//   - their path is, or is within, one of the Prefixes (whole path elements are matched, so "/stuff/tmp" matches
+//     /stuff/tmp/a.doc but not /stuff/tmpfiles/a.doc);
+//   - they are smaller than MinSize bytes, or larger than MaxSize bytes (if MaxSize is greater than 0);
+//   - one of the Funcs returns a reason.
+//
+// Each excluded file is recorded, with the reason, in the Filter's Excluded field.
+type Filter struct {
+	Formats  []string
+	Names    []string
+	Prefixes []string
+	MinSize  int64
+	MaxSize  int64
+	Funcs    []Predicate
+	Excluded Exclusions
+}
+
+// DefaultFilter returns a Filter that excludes common system and temporary files: Thumbs.db, .DS_Store,
+// Office lock files (~$*), zero-byte files and __MACOSX folders.
+func DefaultFilter() *Filter {
+	return &Filter{
+		Names:   []string{"Thumbs.db", ".DS_Store", "~$*", "__MACOSX"},
+		MinSize: 1,
+	}
+}
+
+// Exclude reports whether the file at path, with the given size and format ID, should be skipped.
+// Exclusions are recorded in the Filter's Excluded field.
+func (f *Filter) Exclude(path string, size int64, format string) bool {
+	if f == nil {
+		return false
+	}
+	reason := f.reason(path, size, format)
+	if reason == "" {
+		return false
+	}
+	f.Excluded = append(f.Excluded, Exclusion{path, reason})
+	return true
+}
+
+func (f *Filter) reason(path string, size int64, format string) string {
+	if format != "" {
+		for _, fmtID := range f.Formats {
+			if fmtID == format {
+				return "format " + format
+			}
+		}
+	}
+	// test the file name and each folder name. Container-internal paths (e.g. archive.zip#folder/file.doc) are split on #
+	elements := strings.FieldsFunc(path, func(r rune) bool { return r == '/' || r == '\\' || r == '#' })
+	for _, glob := range f.Names {
+		for _, el := range elements {
+			if ok, _ := filepath.Match(glob, el); ok {
+				return "name matches " + glob
+			}
+		}
+	}
+	for _, prefix := range f.Prefixes {
+		if hasPathPrefix(path, prefix) {
+			return "path starts with " + prefix
+		}
+	}
+	if size < f.MinSize {
+		return fmt.Sprintf("size %d is less than %d", size, f.MinSize)
+	}
+	if f.MaxSize > 0 && size > f.MaxSize {
+		return fmt.Sprintf("size %d is greater than %d", size, f.MaxSize)
+	}
+	for _, fn := range f.Funcs {
+		if reason := fn(path, size, format); reason != "" {
+			return reason
+		}
+	}
+	return ""
+}
+
+// hasPathPrefix reports whether path equals prefix or continues it with a separator (/, \ or # for container-internal paths)
+func hasPathPrefix(path, prefix string) bool {
+	trimmed := strings.TrimRight(prefix, "/\\#")
+	if trimmed == "" {
+		return strings.HasPrefix(path, prefix)
+	}
+	if !strings.HasPrefix(path, trimmed) {
+		return false
+	}
+	return len(path) == len(trimmed) || strings.ContainsRune("/\\#", rune(path[len(trimmed)]))
+}
+
+// Exclusion records a file skipped by a Filter and the reason it was skipped
+type Exclusion struct {
+	Path   string
+	Reason string
+}
+
+// Exclusions lists the files skipped by a Filter
+type Exclusions []Exclusion
+
+// WriteReport writes the exclusions as a CSV file with path and reason columns
+func (es Exclusions) WriteReport(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	w.Write([]string{"path", "reason"})
+	for _, e := range es {
+		w.Write([]string{e.Path, e.Reason})
+	}
+	w.Flush()
+	if err = w.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
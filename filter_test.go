@@ -0,0 +1,96 @@
+// Copyright 2018 State of New South Wales through the State Archives and Records Authority of NSW
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package meta
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	f := DefaultFilter()
+	f.Formats = []string{"fmt/19"}
+	f.Prefixes = []string{"/stuff/tmp/", "/stuff/old"}
+	f.Funcs = []Predicate{func(path string, size int64, format string) string {
+		if strings.HasSuffix(path, ".bak") {
+			return "backup file"
+		}
+		return ""
+	}}
+	for _, tc := range []struct {
+		path    string
+		size    int64
+		format  string
+		exclude bool
+	}{
+		{"/stuff/a.doc", 10, "fmt/40", false},
+		{"/stuff/a.pdf", 10, "fmt/19", true},
+		{"/stuff/Thumbs.db", 10, "", true},
+		{"/stuff/~$a.doc", 10, "", true},
+		{"/stuff/__MACOSX/a.doc", 10, "", true},
+		{"/stuff/a.zip#__MACOSX/a.doc", 10, "", true},
+		{"/stuff/tmp/a.doc", 10, "", true},
+		{"/stuff/tmpfiles/a.doc", 10, "", false},
+		{"/stuff/old.doc", 10, "", false},
+		{"/stuff/old\\a.doc", 10, "", true},
+		{"/stuff/empty.doc", 0, "", true},
+		{"/stuff/a.doc.bak", 10, "", true},
+	} {
+		if got := f.Exclude(tc.path, tc.size, tc.format); got != tc.exclude {
+			t.Errorf("Exclude %s: expecting %v, got %v", tc.path, tc.exclude, got)
+		}
+	}
+	if len(f.Excluded) != 9 || f.Excluded[0].Reason != "format fmt/19" || f.Excluded[8].Reason != "backup file" {
+		t.Errorf("Unexpected exclusions %v", f.Excluded)
+	}
+	var nf *Filter
+	if nf.Exclude("/stuff/Thumbs.db", 0, "") {
+		t.Error("Expecting a nil filter to exclude nothing")
+	}
+}
+
+func TestDirectoryFilter(t *testing.T) {
+	dir := testContent(t)
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "web", "Thumbs.db"), []byte("thumbs"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	d, err := NewDirectory(dir, true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Filter = DefaultFilter()
+	m, err := New(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files := m.Manifest[filepath.Join(dir, "web")].Versions[0].Files; len(files) != 2 {
+		t.Errorf("Expecting Thumbs.db to be excluded, got %v", files)
+	}
+	report := filepath.Join(dir, ExclusionsFile)
+	if err = d.Filter.Excluded.WriteReport(report); err != nil {
+		t.Fatal(err)
+	}
+	byt, err := ioutil.ReadFile(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(byt), "Thumbs.db,name matches Thumbs.db") {
+		t.Errorf("Unexpected report %s", byt)
+	}
+}
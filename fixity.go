@@ -0,0 +1,185 @@
+// Copyright 2018 State of New South Wales through the State Archives and Records Authority of NSW
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package meta
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+)
+
+// SetHashes sets a File's hashes. The first hash is kept in the Hash field and any others in the Hashes field.
+func (f *File) SetHashes(hashes []Hash) {
+	f.Hash, f.Hashes = nil, nil
+	if len(hashes) == 0 {
+		return
+	}
+	h := hashes[0]
+	f.Hash = &h
+	if len(hashes) > 1 {
+		f.Hashes = append([]Hash(nil), hashes[1:]...)
+	}
+}
+
+// AllHashes returns all of a File's hashes (from both the Hash and Hashes fields)
+func (f File) AllHashes() []Hash {
+	if f.Hash == nil {
+		return f.Hashes
+	}
+	return append([]Hash{*f.Hash}, f.Hashes...)
+}
+
+// Hash algorithms supported by HashFile, ManifestCopy and SimpleManifest
+const (
+	MD5    = "md5"
+	SHA1   = "sha1"
+	SHA256 = "sha256"
+	SHA512 = "sha512"
+)
+
+func newHash(alg string) (hash.Hash, error) {
+	switch alg {
+	case MD5:
+		return md5.New(), nil
+	case SHA1:
+		return sha1.New(), nil
+	case SHA256:
+		return sha256.New(), nil
+	case SHA512:
+		return sha512.New(), nil
+	}
+	return nil, fmt.Errorf("meta: unknown hash algorithm %s; expecting md5, sha1, sha256 or sha512", alg)
+}
+
+// CheckAlgorithms returns an error if any of the supplied hash algorithms aren't supported.
+func CheckAlgorithms(algs ...string) error {
+	for _, alg := range algs {
+		if _, err := newHash(alg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkAlgs panics if any of the supplied hash algorithms aren't supported.
+// It is used to check the configuration of actions when they are created.
+func checkAlgs(algs []string) {
+	if err := CheckAlgorithms(algs...); err != nil {
+		panic(err)
+	}
+}
+
+// hasher computes several hashes at once. It is an io.Writer.
+type hasher struct {
+	algs []string
+	hs   []hash.Hash
+	io.Writer
+}
+
+func newHasher(algs []string) (*hasher, error) {
+	h := &hasher{
+		algs: algs,
+		hs:   make([]hash.Hash, len(algs)),
+	}
+	ws := make([]io.Writer, len(algs))
+	for i, alg := range algs {
+		hh, err := newHash(alg)
+		if err != nil {
+			return nil, err
+		}
+		h.hs[i], ws[i] = hh, hh
+	}
+	h.Writer = io.MultiWriter(ws...)
+	return h, nil
+}
+
+func (h *hasher) hashes() []Hash {
+	ret := make([]Hash, len(h.algs))
+	for i, alg := range h.algs {
+		ret[i] = Hash{
+			Algorithm: alg,
+			Value:     hex.EncodeToString(h.hs[i].Sum(nil)),
+		}
+	}
+	return ret
+}
+
+// HashFile computes hashes, using the supplied algorithms, of the file at path
+func HashFile(path string, algs ...string) ([]Hash, error) {
+	h, err := newHasher(algs)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err = io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.hashes(), nil
+}
+
+// copyHash copies the file at src to dst, computing hashes with the supplied algorithms as it copies.
+// The modified time of the source is preserved. The destination is then re-read and its hashes are
+// compared with those of the source. An error is returned if they don't match.
+func copyHash(src, dst string, algs []string) ([]Hash, error) {
+	h, err := newHasher(algs)
+	if err != nil {
+		return nil, err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	fi, err := in.Stat()
+	if err != nil {
+		return nil, err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(io.MultiWriter(out, h), in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = os.Chtimes(dst, fi.ModTime(), fi.ModTime()); err != nil {
+		return nil, err
+	}
+	srcHashes := h.hashes()
+	dstHashes, err := HashFile(dst, algs...)
+	if err != nil {
+		return nil, err
+	}
+	for i := range srcHashes {
+		if srcHashes[i].Value != dstHashes[i].Value {
+			return nil, fmt.Errorf("meta: fixity check failed copying %s to %s; %s of source is %s but destination is %s",
+				src, dst, srcHashes[i].Algorithm, srcHashes[i].Value, dstHashes[i].Value)
+		}
+	}
+	return srcHashes, nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2018 State of New South Wales through the State Archives and Records Authority of NSW
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package meta
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestManifestCopyHash(t *testing.T) {
+	src, err := ioutil.TempDir("", "meta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+	dst, err := ioutil.TempDir("", "meta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dst)
+	if err = ioutil.WriteFile(filepath.Join(src, "hello.txt"), []byte("hello world"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	m := testMeta(1)
+	m.Manifest["object0"].AddVersion([]File{{Name: "hello.txt", Size: 11}})
+	pathfunc := func(m *Meta, index string) string { return src }
+	if err = m.Output(dst, ManifestCopy(pathfunc, MD5, SHA256)); err != nil {
+		t.Fatal(err)
+	}
+	f := m.Manifest["object0"].Versions[0].Files[0]
+	hs := f.AllHashes()
+	if len(hs) != 2 || f.Hash == nil || f.Hash.Algorithm != MD5 {
+		t.Fatalf("Expecting two hashes, with md5 first, got %v", hs)
+	}
+	if hs[0].Value != "5eb63bbbe01eeed093cb22bb8f5acdc3" {
+		t.Errorf("Bad md5, got %s", hs[0].Value)
+	}
+	if hs[1].Value != "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9" {
+		t.Errorf("Bad sha256, got %s", hs[1].Value)
+	}
+	if _, err = os.Stat(filepath.Join(dst, "0", "versions", "0", "hello.txt")); err != nil {
+		t.Errorf("Expecting file to be copied, got %v", err)
+	}
+	// round trip the multiple hashes
+	byts, err := json.Marshal(m.Manifest["object0"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	man := &Manifest{}
+	if err = json.Unmarshal(byts, man); err != nil {
+		t.Fatal(err)
+	}
+	if rhs := man.Versions[0].Files[0].AllHashes(); len(rhs) != 2 || rhs[1] != hs[1] {
+		t.Errorf("Expecting hashes to round trip, got %v", rhs)
+	}
+}
@@ -15,8 +15,12 @@
 package meta
 
 import (
+	"bytes"
 	"encoding/csv"
+	"encoding/json"
 	"os"
+	"path"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -34,12 +38,58 @@ func ToID(i int, pat string) string {
 // ToPUID is a helper function that turns a short PUID (e.g. fmt/1) into a fully qualified PUID
 // (e.g. http://www.nationalarchives.gov.uk/pronom/fmt/1)
 func ToPUID(puid string) string {
-	if !strings.HasPrefix(puid, "fmt/") && !strings.HasPrefix(puid, "x-fmt/") {
+	if !isPUID(puid) {
 		return puid
 	}
 	return "http://www.nationalarchives.gov.uk/pronom/" + puid
 }
 
+// uniqueName returns name, or if it has already been used, the name with a number added e.g. a (2).pdf.
+// Names are compared case-insensitively, as they would be on Windows, and the returned name is marked as used.
+func uniqueName(name string, used map[string]bool) string {
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for n := 2; used[strings.ToLower(name)]; n++ {
+		name = base + " (" + strconv.Itoa(n) + ")" + ext
+	}
+	used[strings.ToLower(name)] = true
+	return name
+}
+
+// renamed returns a unique name for a file derived from the file called name, with its extension replaced by ext (e.g. ".pdf")
+func renamed(name, ext string, used map[string]bool) string {
+	return uniqueName(strings.TrimSuffix(name, path.Ext(name))+ext, used)
+}
+
+// isPUID reports whether an ID is a short PUID (e.g. fmt/1 or x-fmt/1) rather than e.g. a MIME type from a MIME-based identifier
+func isPUID(id string) bool {
+	return strings.HasPrefix(id, "fmt/") || strings.HasPrefix(id, "x-fmt/")
+}
+
+// archiveExts are the file extensions of the archive formats that siegfried scans within (with the -z flag)
+var archiveExts = map[string]bool{
+	".zip":  true,
+	".tar":  true,
+	".gz":   true,
+	".tgz":  true,
+	".gzip": true,
+	".arc":  true,
+	".warc": true,
+}
+
+// SplitContainerPath is a helper function that splits a container-internal path, as reported by siegfried when scanning
+// within archives (e.g. archive.zip#folder/file.doc), into the path to the archive and the path within it.
+// The path is split at the first # that follows an archive extension, so a # elsewhere in a file or folder name is kept.
+// Returns false if the path isn't a container-internal path.
+func SplitContainerPath(path string) (archive, member string, ok bool) {
+	for idx := 1; idx < len(path)-1; idx++ {
+		if path[idx] == '#' && archiveExts[strings.ToLower(filepath.Ext(path[:idx]))] {
+			return path[:idx], path[idx+1:], true
+		}
+	}
+	return "", "", false
+}
+
 // ToRef is a helper function that turns an integer identififier into a string ref:I reference.
 // It is used for placedholder IDs like log:1 that get swapped out by the Migrate tool.
 func ToRef(i int, ref string) string {
@@ -92,6 +142,36 @@ func copyVarStr(v VarStr) VarStr {
 	return ret
 }
 
+// strs returns the strings in a VarStr as a slice
+func strs(v VarStr) []string {
+	switch vs := v.(type) {
+	case string:
+		if vs == "" {
+			return nil
+		}
+		return []string{vs}
+	case []string:
+		return vs
+	}
+	return nil
+}
+
+// unmarshalVarStr unmarshals a json string or array of strings into a VarStr
+func unmarshalVarStr(raw json.RawMessage) (VarStr, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	if raw[0] == '[' {
+		var strs []string
+		err := json.Unmarshal(raw, &strs)
+		return strs, err
+	}
+	var str string
+	err := json.Unmarshal(raw, &str)
+	return str, err
+}
+
 func SetVarStr(v VarStr) VarStr {
 	if v == nil {
 		return nil
@@ -133,6 +213,38 @@ func AppendAgent(a, b Agent) Agent {
 	return []Agent{a, b}
 }
 
+// unmarshalAgent unmarshals a json string, object or array into an Agent.
+// Objects become Objs and arrays become slices of Agents.
+func unmarshalAgent(raw json.RawMessage) (Agent, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	switch raw[0] {
+	case '[':
+		var raws []json.RawMessage
+		if err := json.Unmarshal(raw, &raws); err != nil {
+			return nil, err
+		}
+		agents := make([]Agent, len(raws))
+		for i, r := range raws {
+			a, err := unmarshalAgent(r)
+			if err != nil {
+				return nil, err
+			}
+			agents[i] = a
+		}
+		return agents, nil
+	case '{':
+		var obj Obj
+		err := json.Unmarshal(raw, &obj)
+		return obj, err
+	}
+	var str string
+	err := json.Unmarshal(raw, &str)
+	return str, err
+}
+
 // MakeSDOPerson creates an Agent that is of @type schema.org/Person. Does not set an @id.
 func MakeSDOPerson(name string) Agent {
 	return MakeAgent(name, "", "http://schema.org/Person")
@@ -211,6 +323,81 @@ func ReferenceMigration(i int) string {
 	return ToRef(i, "mig")
 }
 
+// unmarshalThing unmarshals a json string, object or array into a Thing.
+// Objects with business fields become Businesses, other objects become Objs and arrays become slices of Things.
+func unmarshalThing(raw json.RawMessage) (Thing, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	switch raw[0] {
+	case '[':
+		var raws []json.RawMessage
+		if err := json.Unmarshal(raw, &raws); err != nil {
+			return nil, err
+		}
+		things := make([]Thing, len(raws))
+		for i, r := range raws {
+			t, err := unmarshalThing(r)
+			if err != nil {
+				return nil, err
+			}
+			things[i] = t
+		}
+		return things, nil
+	case '{':
+		var flds map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &flds); err != nil {
+			return nil, err
+		}
+		for _, k := range []string{"legalName", "registrationNumber", "abn", "proprietor"} {
+			if _, ok := flds[k]; ok {
+				var bus Business
+				err := json.Unmarshal(raw, &bus)
+				return bus, err
+			}
+		}
+		var obj Obj
+		err := json.Unmarshal(raw, &obj)
+		return obj, err
+	}
+	var str string
+	err := json.Unmarshal(raw, &str)
+	return str, err
+}
+
+// unmarshalContainer unmarshals a json string, object or array into a Container.
+// Objects become Objs and arrays become slices of Containers.
+func unmarshalContainer(raw json.RawMessage) (Container, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	switch raw[0] {
+	case '[':
+		var raws []json.RawMessage
+		if err := json.Unmarshal(raw, &raws); err != nil {
+			return nil, err
+		}
+		containers := make([]Container, len(raws))
+		for i, r := range raws {
+			c, err := unmarshalContainer(r)
+			if err != nil {
+				return nil, err
+			}
+			containers[i] = c
+		}
+		return containers, nil
+	case '{':
+		var obj Obj
+		err := json.Unmarshal(raw, &obj)
+		return obj, err
+	}
+	var str string
+	err := json.Unmarshal(raw, &str)
+	return str, err
+}
+
 func MakeContainer(title, id, typ string) Container {
 	return Obj{
 		ID:    id,
@@ -20,12 +20,35 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/richardlehane/siegfried/pkg/config"
+	"github.com/richardlehane/siegfried/pkg/core"
 	"github.com/richardlehane/siegfried/pkg/reader"
 )
 
 // Siegfried loader. Reads a siegfried file (or droid or fido) to generate generic digital objects
+//
+// If the results file has more than one identifier, the first is used to set each file's format unless the name of
+// a preferred Identifier is given (e.g. "pronom"). Files that aren't identified (UNKNOWN) are given no format.
+// When the preferred identifier is MIME-based (e.g. tika or freedesktop), a file's PUID is taken from another
+// (PRONOM-based) identifier in the results, if there is one.
+// If Warnings is set, a format identification Log is added to each object that has identification warnings
+// (e.g. "extension mismatch") or that has been identified by more than one identifier. The log records the
+// identifications (and any warnings) from all identifiers.
+//
+// Results from scanning within archives (siegfried's -z flag) include container-internal paths like archive.zip#folder/file.doc.
+// These archive members never become objects of their own. By default they are ignored, as the archive is copied as a single file.
+// If Members is set, they are added to their archive's object as a version derived from the archive, just as the Decompress action
+// would add them. Each member is named by its path within the archive, with its full container-internal path kept in its OriginalName.
+// Nested archives aren't listed themselves, only their contents.
+// ManifestCopy doesn't copy archive members, so only set Members when the Decompress action will unpack them.
+//
+// Files can be excluded by format ID with the Blacklist or, more generally, with a Filter.
 type Siegfried struct {
-	Blacklist []string
+	Blacklist  []string
+	Filter     *Filter
+	Identifier string
+	Warnings   bool
+	Members    bool
 	reader.Reader
 }
 
@@ -33,7 +56,7 @@ type Siegfried struct {
 // The blacklist is IDs you'd like to exclude e.g. to prune thumbs db files
 func NewSiegfried(rdr io.Reader, blacklist ...string) (*Siegfried, error) {
 	srdr, err := reader.New(rdr, "")
-	return &Siegfried{blacklist, srdr}, err
+	return &Siegfried{Blacklist: blacklist, Reader: srdr}, err
 }
 
 func (s *Siegfried) Load(m *Meta) error {
@@ -41,22 +64,45 @@ func (s *Siegfried) Load(m *Meta) error {
 		f   reader.File
 		err error
 	)
-	// first check that we just have a single indentifier
-	if len(s.Head().Identifiers) != 1 {
-		return fmt.Errorf("meta: siegfried loader can only process single IDs, have %d IDs for file %s", len(f.IDs), f.Path)
+	head := s.Head()
+	if len(head.Identifiers) == 0 {
+		return fmt.Errorf("meta: siegfried loader found no identifiers in results file")
+	}
+	// choose the preferred identifier
+	pref := 0
+	if s.Identifier != "" {
+		pref = -1
+		for i, v := range head.Identifiers {
+			if v[0] == s.Identifier {
+				pref = i
+				break
+			}
+		}
+		if pref < 0 {
+			return fmt.Errorf("meta: siegfried loader can't find identifier %s in results file", s.Identifier)
+		}
 	}
 	mimeField := -1
-	for i, v := range s.Head().Fields[0] {
+	for i, v := range head.Fields[pref] {
 		if v == "mime" || v == "MIME" {
 			mimeField = i
 			break
 		}
 	}
 	if mimeField < 0 {
-		return fmt.Errorf("meta: siegfried loader expects a single identifier that has a MIME field")
+		return fmt.Errorf("meta: siegfried loader expects the %s identifier to have a MIME field", head.Identifiers[pref][0])
 	}
+	// archive members (from scanning within archives) are collected by archive and added once all results are read
+	members := make(map[string][]File)
+	var archives []string
 	for f, err = s.Next(); err == nil; f, err = s.Next() {
-		id := f.IDs[0]
+		if len(f.IDs) <= pref {
+			if err = m.Fail(f.Path, "meta.Siegfried", fmt.Errorf("meta: siegfried loader expects %d IDs for file %s, have %d", len(head.Identifiers), f.Path, len(f.IDs))); err != nil {
+				return err
+			}
+			continue
+		}
+		id := f.IDs[pref]
 		// check the blacklist
 		var isBlackListed bool
 		for _, black := range s.Blacklist {
@@ -65,7 +111,42 @@ func (s *Siegfried) Load(m *Meta) error {
 				break
 			}
 		}
-		if isBlackListed {
+		if isBlackListed || s.Filter.Exclude(f.Path, f.Size, id.String()) {
+			continue
+		}
+		var puid, mime string
+		if id.Known() && id.String() != "UNKNOWN" {
+			puid, mime = pronomID(f.IDs, pref), id.Values()[mimeField]
+		}
+		if archive, member, ok := SplitContainerPath(f.Path); ok {
+			if !s.Members || puid != "" && config.IsArchive(puid) > 0 {
+				continue // nested archives are represented by their contents
+			}
+			if _, ok := members[archive]; !ok {
+				archives = append(archives, archive)
+			}
+			var hash *Hash
+			if head.HashHeader != "" {
+				hash = &Hash{
+					Algorithm: head.HashHeader,
+					Value:     string(f.Hash),
+				}
+			}
+			members[archive] = append(members[archive], File{
+				Name:         member,
+				OriginalName: f.Path,
+				Size:         f.Size,
+				Modified:     NewDateTime(f.Mod),
+				MIME:         mime,
+				PUID:         ToPUID(puid),
+				Hash:         hash,
+			})
+			if s.Warnings {
+				if l := s.identificationLog(len(m.Logs[archive]), f.IDs); l != nil {
+					l.Detail = member + ": " + l.Detail
+					m.Logs[archive] = append(m.Logs[archive], l)
+				}
+			}
 			continue
 		}
 		fname := filepath.Base(f.Path)
@@ -73,9 +154,9 @@ func (s *Siegfried) Load(m *Meta) error {
 		modT := NewDateTime(f.Mod)
 		met.Created = WrapDate(*modT)
 		var hash *Hash
-		if s.Head().HashHeader != "" {
+		if head.HashHeader != "" {
 			hash = &Hash{
-				Algorithm: s.Head().HashHeader,
+				Algorithm: head.HashHeader,
 				Value:     string(f.Hash),
 			}
 		}
@@ -83,18 +164,219 @@ func (s *Siegfried) Load(m *Meta) error {
 			Name:     fname,
 			Size:     f.Size,
 			Modified: modT,
-			MIME:     id.Values()[mimeField],
-			PUID:     "http://www.nationalarchives.gov.uk/pronom/" + id.String(),
+			MIME:     mime,
+			PUID:     ToPUID(puid),
 			Hash:     hash,
 		}})
 		m.Index = append(m.Index, f.Path)
 		m.Metadata[f.Path] = met
 		m.Manifest[f.Path] = man
+		if s.Warnings {
+			if l := s.identificationLog(len(m.Logs[f.Path]), f.IDs); l != nil {
+				m.Logs[f.Path] = append(m.Logs[f.Path], l)
+			}
+		}
+	}
+	if err != io.EOF {
+		return err
+	}
+	// add archive members to their archives as derived versions
+	for _, archive := range archives {
+		man, ok := m.Manifest[archive]
+		if !ok || len(man.Versions) != 1 {
+			if err = m.Fail(archive, "meta.Siegfried", fmt.Errorf("meta: siegfried loader has no object for archive %s to add its %d members to", archive, len(members[archive]))); err != nil {
+				return err
+			}
+			continue
+		}
+		man.AddVersion(members[archive])
+		man.Versions[1].DerivedFrom, man.Versions[1].listed = ReferenceVersion(0), true
+	}
+	return nil
+}
+
+// pronomID returns the PUID for a file's IDs: the preferred ID if it is a PUID, otherwise the first ID that is.
+// Returns an empty string if there is no PUID.
+func pronomID(ids []core.Identification, pref int) string {
+	if isPUID(ids[pref].String()) {
+		return ids[pref].String()
+	}
+	for _, id := range ids {
+		if isPUID(id.String()) {
+			return id.String()
+		}
+	}
+	return ""
+}
+
+// identificationLog returns a format identification Log for a file's IDs if any have warnings or there is more than one.
+// Returns nil otherwise.
+func (s *Siegfried) identificationLog(n int, ids []core.Identification) *Log {
+	head := s.Head()
+	warn := len(ids) > 1
+	details := make([]string, len(ids))
+	for i, id := range ids {
+		var name string
+		if i < len(head.Identifiers) {
+			name = head.Identifiers[i][0] + ": "
+		}
+		details[i] = name + id.String()
+		if w := id.Warn(); w != "" {
+			details[i] += " (" + w + ")"
+			warn = true
+		}
 	}
-	if err == io.EOF {
-		err = nil
+	if !warn {
+		return nil
+	}
+	l := NewLog(n, FormatIdentificationEvent)
+	if !head.Scanned.IsZero() {
+		t := head.Scanned
+		l.End = &t
+	}
+	var version string
+	if head.Version != [3]int{} {
+		version = fmt.Sprintf("%d.%d.%d", head.Version[0], head.Version[1], head.Version[2])
+	}
+	l.Agent = MakeSoftware("siegfried", version)
+	l.Detail = strings.Join(details, "; ")
+	return l
+}
+
+// SIPDir loader. Reads a directory of SIPs previously generated by Output back into a Meta so they can be patched and re-output.
+// Each numbered folder (0, 1, 2...) is read in numeric order and its metadata.json, manifest.json and logs are loaded.
+// Objects are indexed by the path to their numbered folder, so a pathfunc for ManifestCopy can find the original
+// versions by joining the index with the version's base.
+type SIPDir string
+
+func (s SIPDir) Load(m *Meta) error {
+	paths, err := ListSIPs(string(s))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		met, man, logs, err := ReadSIP(path)
+		if err != nil {
+			if err = m.Fail(path, "meta.SIPDir", err); err != nil {
+				return err
+			}
+			continue
+		}
+		m.Index = append(m.Index, path)
+		m.Metadata[path] = met
+		m.Manifest[path] = man
+		if len(logs) > 0 {
+			m.Logs[path] = logs
+		}
+	}
+	return nil
+}
+
+// Group loader. Merges objects into multi-file objects e.g. to make one object per folder from the one object per file
+// created by the Siegfried loader. The Group func returns a key for each index: objects with the same key are merged into
+// a single object that is indexed by the key and placed at the position of the first of them.
+//
+// Objects are assumed to be indexed by file path (as they are by the Siegfried and Directory loaders).
+// Each file's name is made relative to the key when the key is a folder that contains it (e.g. images/photo.jpg),
+// and the file's original path is kept in its OriginalName. Files in the same version of each object are merged into
+// the same version of the group. The group takes the metadata of its first object, with a title from the key and
+// the earliest created date of the objects.
+//
+// The logs of the objects are merged too, with their IDs and any file references renumbered for the group (as are
+// the isPartOf references of files).
+// Group should be applied before loaders that add access rules: objects that have them can't be merged.
+type Group func(m *Meta, index string) string
+
+// ByFolder is a Group func that groups files by the folder they are in. Use FolderPath with ManifestCopy for the groups.
+func ByFolder(m *Meta, index string) string {
+	return filepath.Dir(index)
+}
+
+func (g Group) Load(m *Meta) error {
+	groups := make(map[string][]string)
+	order := make([]string, 0, len(m.Index))
+	first := make(map[string]int) // position in the index of each group's first object
+	for i, idx := range m.Index {
+		k := g(m, idx)
+		if _, ok := groups[k]; !ok {
+			order = append(order, k)
+			first[k] = i
+		}
+		groups[k] = append(groups[k], idx)
+	}
+	index := make([]string, 0, len(order))
+	metadata, manifest := make(map[string]*Metadata), make(map[string]*Manifest)
+	logs := make(map[string][]*Log)
+	for _, k := range order {
+		members := groups[k]
+		var versions [][]File
+		var derived, generated []string // each version's derivedFrom and generatedBy
+		var listed []bool
+		met := m.Metadata[members[0]]
+		for _, idx := range members {
+			man := m.Manifest[idx]
+			if len(man.AccessRules) > 0 {
+				return fmt.Errorf("meta: group loader can't merge %s as it has access rules; apply the group loader first", idx)
+			}
+			if created := m.Metadata[idx].Created; created != nil && (met.Created == nil || created.Before(met.Created.Time)) {
+				met.Created = created
+			}
+			refs := make(map[string]string) // the object's file and log references and their references in the group
+			for i := range m.Logs[idx] {
+				refs[ReferenceLog(i)] = ReferenceLog(len(logs[k]) + i)
+			}
+			for vidx, v := range man.Versions {
+				if vidx >= len(versions) {
+					versions = append(versions, nil)
+					derived, generated = append(derived, v.DerivedFrom), append(generated, refs[v.GeneratedBy])
+					listed = append(listed, v.listed)
+				}
+				for fidx, f := range v.Files {
+					refs[FileTarget{vidx, fidx}.String()] = FileTarget{vidx, len(versions[vidx])}.String()
+					orig := filepath.Join(filepath.Dir(idx), filepath.FromSlash(f.Name))
+					if rel, err := filepath.Rel(k, orig); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+						f.Name = filepath.ToSlash(rel)
+					}
+					if f.OriginalName == "" {
+						f.OriginalName = orig
+					}
+					if r, ok := refs[f.IsPartOf]; ok {
+						f.IsPartOf = r
+					}
+					versions[vidx] = append(versions[vidx], f)
+				}
+			}
+			for _, l := range m.Logs[idx] {
+				l.ID = ReferenceLog(len(logs[k]))
+				l.Sources, l.Outputs = renumber(l.Sources, refs), renumber(l.Outputs, refs)
+				logs[k] = append(logs[k], l)
+			}
+		}
+		if met.ID == ReferenceObject(first[k]) {
+			met.ID = ReferenceObject(len(index))
+		}
+		met.Title = filepath.Base(k)
+		man := NewManifest()
+		for vidx, files := range versions {
+			man.AddVersion(files)
+			man.Versions[vidx].DerivedFrom, man.Versions[vidx].GeneratedBy = derived[vidx], generated[vidx]
+			man.Versions[vidx].listed = listed[vidx]
+		}
+		index = append(index, k)
+		metadata[k], manifest[k] = met, man
+	}
+	m.Index, m.Metadata, m.Manifest, m.Logs = index, metadata, manifest, logs
+	return nil
+}
+
+// renumber replaces references using a map of old references to new ones
+func renumber(refs []string, replace map[string]string) []string {
+	for i, ref := range refs {
+		if r, ok := replace[ref]; ok {
+			refs[i] = r
+		}
 	}
-	return err
+	return refs
 }
 
 // GlobalAccess loader. Applies a simple, global access rule to all digital objects
@@ -0,0 +1,277 @@
+// Copyright 2018 State of New South Wales through the State Archives and Records Authority of NSW
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package meta
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/richardlehane/siegfried/pkg/config"
+	"github.com/richardlehane/siegfried/pkg/core"
+	"github.com/richardlehane/siegfried/pkg/reader"
+)
+
+func TestSIPDir(t *testing.T) {
+	m, err := New(SIPDir(filepath.Join("examples", "project-0")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Index) != 1 || m.Index[0] != filepath.Join("examples", "project-0", "0") {
+		t.Fatalf("Expecting a single index entry for examples/project-0/0, got %v", m.Index)
+	}
+	idx := m.Index[0]
+	met := m.Metadata[idx]
+	if typs, ok := met.Typ.([]string); !ok || len(typs) != 2 {
+		t.Errorf("Expecting @type to be a slice of two strings, got %v", met.Typ)
+	}
+	if agents, ok := met.Creator.([]Agent); !ok {
+		t.Errorf("Expecting creator to be a slice of Agents, got %T", met.Creator)
+	} else if _, ok := agents[0].(Obj); !ok {
+		t.Errorf("Expecting creator to be an Obj, got %T", agents[0])
+	}
+	if _, ok := met.DisposalRule.(DisposalRule); !ok {
+		t.Errorf("Expecting a DisposalRule, got %T", met.DisposalRule)
+	}
+	if met.Created.String() != "1998" {
+		t.Errorf("Expecting created date to keep its precision, got %s", met.Created)
+	}
+	if err = compare(met, filepath.Join("project-0", "0", "metadata.json")); err != nil {
+		t.Error(err)
+	}
+	if err = compare(m.Manifest[idx], filepath.Join("project-0", "0", "manifest.json")); err != nil {
+		t.Error(err)
+	}
+	if len(m.Logs[idx]) != 1 {
+		t.Fatalf("Expecting a single log, got %d", len(m.Logs[idx]))
+	}
+	if err = compare(m.Logs[idx][0], filepath.Join("project-0", "0", "logs", "0.json")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGroup(t *testing.T) {
+	dir := testContent(t)
+	defer os.RemoveAll(dir)
+	d, err := NewDirectory(dir, false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	web := filepath.Join(dir, "web")
+	// group everything in the web folder, including subfolders
+	m, err := New(d, Group(func(m *Meta, index string) string {
+		if strings.HasPrefix(index, web) {
+			return web
+		}
+		return ByFolder(m, index)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Index) != 2 || m.Index[0] != dir || m.Index[1] != web {
+		t.Fatalf("Expecting 2 objects, got %v", m.Index)
+	}
+	if m.Metadata[web].ID != ReferenceObject(1) || m.Metadata[web].Title != "web" {
+		t.Errorf("Unexpected group metadata %v", m.Metadata[web])
+	}
+	files := m.Manifest[web].Versions[0].Files
+	if len(files) != 3 || files[0].Name != "images/photo.jpg" || files[0].OriginalName != filepath.Join(web, "images", "photo.jpg") || files[2].ID != "_:v0f2" {
+		t.Errorf("Unexpected group files %v", files)
+	}
+	// copy the grouped files
+	out, err := ioutil.TempDir("", "meta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(out)
+	if err = m.Output(out, ManifestCopy(FolderPath, MD5)); err != nil {
+		t.Fatal(err)
+	}
+	if ds, err := Verify(out); err != nil || len(ds) != 0 {
+		t.Errorf("Expecting grouped files to be copied, got %v %v", ds, err)
+	}
+}
+
+type testID struct {
+	id, mime, warn string
+}
+
+func (t testID) String() string          { return t.id }
+func (t testID) Known() bool             { return t.id != "UNKNOWN" }
+func (t testID) Warn() string            { return t.warn }
+func (t testID) Values() []string        { return []string{"pronom", t.id, "", "", t.mime, "", t.warn} }
+func (t testID) Archive() config.Archive { return 0 }
+
+type testReader struct {
+	files []reader.File
+}
+
+func (t *testReader) Head() reader.Head {
+	return reader.Head{
+		Scanned:     time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC),
+		Version:     [3]int{1, 7, 8},
+		Identifiers: [][2]string{{"pronom", ""}, {"tika", ""}},
+		Fields:      [][]string{{"namespace", "id", "format", "version", "mime", "basis", "warning"}, {"namespace", "id", "format", "version", "mime", "basis", "warning"}},
+	}
+}
+
+func (t *testReader) Next() (reader.File, error) {
+	if len(t.files) == 0 {
+		return reader.File{}, io.EOF
+	}
+	f := t.files[0]
+	t.files = t.files[1:]
+	return f, nil
+}
+
+func TestSiegfried(t *testing.T) {
+	rdr := &testReader{[]reader.File{
+		{Path: "/stuff/a.pdf", Size: 10, Mod: "2017-01-01T10:00:00+10:00", IDs: []core.Identification{
+			testID{"fmt/19", "application/pdf", ""}, testID{"application/pdf", "application/pdf", ""}}},
+		{Path: "/stuff/b.doc", Size: 10, Mod: "2017-01-01T10:00:00+10:00", IDs: []core.Identification{
+			testID{"fmt/19", "application/pdf", "extension mismatch"}, testID{"application/pdf", "application/pdf", ""}}},
+		{Path: "/stuff/c.xyz", Size: 10, Mod: "2017-01-01T10:00:00+10:00", IDs: []core.Identification{
+			testID{"UNKNOWN", "", "no match"}, testID{"application/octet-stream", "application/octet-stream", ""}}},
+	}}
+	m, err := New(&Siegfried{Reader: rdr, Identifier: "pronom", Warnings: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := m.Manifest["/stuff/a.pdf"].Versions[0].Files[0]; f.PUID != "http://www.nationalarchives.gov.uk/pronom/fmt/19" || f.MIME != "application/pdf" {
+		t.Errorf("Unexpected format %s %s", f.PUID, f.MIME)
+	}
+	if f := m.Manifest["/stuff/c.xyz"].Versions[0].Files[0]; f.PUID != "" || f.MIME != "" {
+		t.Errorf("Expecting no format for UNKNOWN, got %s %s", f.PUID, f.MIME)
+	}
+	logs := m.Logs["/stuff/b.doc"]
+	if len(logs) != 1 || logs[0].Typ != FormatIdentificationEvent || logs[0].Detail != "pronom: fmt/19 (extension mismatch); tika: application/pdf" {
+		t.Errorf("Expecting a format identification log with the warning, got %v", logs)
+	}
+}
+
+func TestSiegfriedMIMEIdentifier(t *testing.T) {
+	rdr := &testReader{[]reader.File{
+		{Path: "/stuff/a.pdf", Size: 10, Mod: "2017-01-01T10:00:00+10:00", IDs: []core.Identification{
+			testID{"fmt/19", "application/pdf", ""}, testID{"application/pdf", "application/pdf", ""}}},
+	}}
+	m, err := New(&Siegfried{Reader: rdr, Identifier: "tika"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := m.Manifest["/stuff/a.pdf"].Versions[0].Files[0]; f.PUID != "http://www.nationalarchives.gov.uk/pronom/fmt/19" || f.MIME != "application/pdf" {
+		t.Errorf("Expecting the PUID from the pronom identifier, got %s %s", f.PUID, f.MIME)
+	}
+}
+
+func TestGroupLogs(t *testing.T) {
+	rdr := &testReader{[]reader.File{
+		{Path: "/stuff/a.pdf", Size: 10, Mod: "2017-01-01T10:00:00+10:00", IDs: []core.Identification{
+			testID{"fmt/19", "application/pdf", "extension mismatch"}, testID{"application/pdf", "application/pdf", ""}}},
+		{Path: "/stuff/b.doc", Size: 10, Mod: "2017-01-01T10:00:00+10:00", IDs: []core.Identification{
+			testID{"fmt/19", "application/pdf", "extension mismatch"}, testID{"application/pdf", "application/pdf", ""}}},
+	}}
+	m, err := New(&Siegfried{Reader: rdr, Warnings: true}, Group(ByFolder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs := m.Logs["/stuff"]
+	if len(m.Index) != 1 || len(logs) != 2 || logs[1].ID != ReferenceLog(1) {
+		t.Fatalf("Expecting the objects' logs to be merged, got %v", logs)
+	}
+	if errs := m.Validate(); errs != nil {
+		t.Error(errs)
+	}
+}
+
+func TestGroupIsPartOf(t *testing.T) {
+	m := testMeta(2)
+	for _, idx := range m.Index {
+		man := m.Manifest[idx]
+		man.AddVersion([]File{{Name: idx + ".eml"}})
+		man.AddVersion([]File{{Name: idx + ".pdf", IsPartOf: "_:v0f0"}})
+	}
+	if err := Group(func(m *Meta, index string) string { return "messages" }).Load(m); err != nil {
+		t.Fatal(err)
+	}
+	man := m.Manifest["messages"]
+	if f := man.Versions[1].Files[1]; f.Name != "object1.pdf" || f.IsPartOf != "_:v0f1" {
+		t.Errorf("Expecting the attachment to be part of the second message, got %v", f)
+	}
+	if errs := ValidateManifest("messages", man, nil); errs != nil {
+		t.Error(errs)
+	}
+}
+
+func TestSiegfriedArchive(t *testing.T) {
+	rdr := &testReader{[]reader.File{
+		{Path: "/stuff/a.zip", Size: 100, Mod: "2017-01-01T10:00:00+10:00", IDs: []core.Identification{
+			testID{"x-fmt/263", "application/zip", ""}, testID{"application/zip", "application/zip", ""}}},
+		{Path: "/stuff/a.zip#folder/b.pdf", Size: 10, Mod: "2017-01-01T10:00:00+10:00", IDs: []core.Identification{
+			testID{"fmt/19", "application/pdf", ""}, testID{"application/pdf", "application/pdf", ""}}},
+		{Path: "/stuff/a.zip#c.txt", Size: 10, Mod: "2017-01-01T10:00:00+10:00", IDs: []core.Identification{
+			testID{"x-fmt/111", "text/plain", ""}, testID{"text/plain", "text/plain", ""}}},
+	}}
+	files := append([]reader.File{}, rdr.files...)
+	m, err := New(&Siegfried{Reader: rdr, Identifier: "pronom"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Index) != 1 || len(m.Manifest["/stuff/a.zip"].Versions) != 1 {
+		t.Fatalf("Expecting archive members to be ignored, got %v", m.Index)
+	}
+	m, err = New(&Siegfried{Reader: &testReader{files}, Identifier: "pronom", Members: true}, Group(ByFolder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Index) != 1 {
+		t.Fatalf("Expecting a single object for the archive, got %v", m.Index)
+	}
+	man := m.Manifest["/stuff"]
+	if len(man.Versions) != 2 || man.Versions[1].DerivedFrom != "_:v0" || len(man.Versions[1].Files) != 2 {
+		t.Fatalf("Expecting archive members as a derived version, got %v", man.Versions)
+	}
+	if f := man.Versions[1].Files[0]; f.Name != "folder/b.pdf" || f.OriginalName != "/stuff/a.zip#folder/b.pdf" || f.MIME != "application/pdf" {
+		t.Errorf("Unexpected archive member %v", f)
+	}
+	if !man.Versions[1].listed {
+		t.Error("Expecting the derived version to be recognised as archive members")
+	}
+	if errs := m.Validate(); errs != nil {
+		t.Error(errs)
+	}
+}
+
+func TestSplitContainerPath(t *testing.T) {
+	for _, c := range []struct {
+		path, archive, member string
+		ok                    bool
+	}{
+		{"/stuff/a.zip#folder/b.doc", "/stuff/a.zip", "folder/b.doc", true},
+		{"/stuff/Invoice #3.zip#a.doc", "/stuff/Invoice #3.zip", "a.doc", true},
+		{"/st#uff/a.zip#b.doc", "/st#uff/a.zip", "b.doc", true},
+		{"/stuff/a.zip#b.zip#c.doc", "/stuff/a.zip", "b.zip#c.doc", true},
+		{"/stuff/Invoice #3.doc", "", "", false},
+		{"/stuff/a.zip#", "", "", false},
+	} {
+		archive, member, ok := SplitContainerPath(c.path)
+		if archive != c.archive || member != c.member || ok != c.ok {
+			t.Errorf("%s: expecting %s, %s, %v; got %s, %s, %v", c.path, c.archive, c.member, c.ok, archive, member, ok)
+		}
+	}
+}
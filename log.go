@@ -14,25 +14,106 @@
 
 package meta
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // Log represents a preservation event e.g. format migration.
 // The PROV and PREMIS ontologies are primarily used for this metadata.
+// The Outcome field records whether the event succeeded (see OutcomeSuccess, OutcomeFailure and OutcomeWarning) and
+// the OutcomeDetail field has any notes about the outcome e.g. error messages. This means that failed events, like a
+// failed migration attempt, can be preserved alongside successful ones.
+// The Sources and Outputs fields link the event to the files it acted on and the files it produced (e.g. _:v0f0).
 type Log struct {
-	ID      string     `json:"@id"`
-	Typ     string     `json:"@type"` // from http://id.loc.gov/vocabulary/preservation/eventType.html e.g. http://id.loc.gov/vocabulary/preservation/eventType/mig
-	Start   *time.Time `json:"startTime,omitempty"`
-	End     *time.Time `json:"endTime"`
-	Detail  string     `json:"detail"`
-	Agent   Agent      `json:"agent"`
-	Context Context    `json:"@context"`
+	ID            string     `json:"@id"`
+	Typ           string     `json:"@type"` // from http://id.loc.gov/vocabulary/preservation/eventType.html e.g. http://id.loc.gov/vocabulary/preservation/eventType/mig
+	Start         *time.Time `json:"startTime,omitempty"`
+	End           *time.Time `json:"endTime"`
+	Detail        string     `json:"detail"`
+	Outcome       string     `json:"outcome,omitempty"`
+	OutcomeDetail string     `json:"outcomeDetail,omitempty"`
+	Sources       []string   `json:"source,omitempty"`
+	Outputs       []string   `json:"output,omitempty"`
+	Agent         Agent      `json:"agent"`
+	Context       Context    `json:"@context"`
 }
 
+// Event types from the PREMIS eventType vocabulary (http://id.loc.gov/vocabulary/preservation/eventType.html)
+const (
+	AccessionEvent                   = "http://id.loc.gov/vocabulary/preservation/eventType/acc"
+	AppraisalEvent                   = "http://id.loc.gov/vocabulary/preservation/eventType/app"
+	CaptureEvent                     = "http://id.loc.gov/vocabulary/preservation/eventType/cap"
+	CompressionEvent                 = "http://id.loc.gov/vocabulary/preservation/eventType/com"
+	CreationEvent                    = "http://id.loc.gov/vocabulary/preservation/eventType/cre"
+	DeaccessionEvent                 = "http://id.loc.gov/vocabulary/preservation/eventType/dea"
+	DecompressionEvent               = "http://id.loc.gov/vocabulary/preservation/eventType/dec"
+	DecryptionEvent                  = "http://id.loc.gov/vocabulary/preservation/eventType/der"
+	DeletionEvent                    = "http://id.loc.gov/vocabulary/preservation/eventType/del"
+	DigitalSignatureGenerationEvent  = "http://id.loc.gov/vocabulary/preservation/eventType/dig"
+	DigitalSignatureValidationEvent  = "http://id.loc.gov/vocabulary/preservation/eventType/dsv"
+	DisseminationEvent               = "http://id.loc.gov/vocabulary/preservation/eventType/dis"
+	EncryptionEvent                  = "http://id.loc.gov/vocabulary/preservation/eventType/enc"
+	ExecutionEvent                   = "http://id.loc.gov/vocabulary/preservation/eventType/exe"
+	FilenameChangeEvent              = "http://id.loc.gov/vocabulary/preservation/eventType/fil"
+	FixityCheckEvent                 = "http://id.loc.gov/vocabulary/preservation/eventType/fix"
+	ForensicFeatureAnalysisEvent     = "http://id.loc.gov/vocabulary/preservation/eventType/for"
+	FormatIdentificationEvent        = "http://id.loc.gov/vocabulary/preservation/eventType/fmi"
+	ImagingEvent                     = "http://id.loc.gov/vocabulary/preservation/eventType/ima"
+	InformationPackageCreationEvent  = "http://id.loc.gov/vocabulary/preservation/eventType/ipc"
+	InformationPackageMergingEvent   = "http://id.loc.gov/vocabulary/preservation/eventType/ipm"
+	InformationPackageSplittingEvent = "http://id.loc.gov/vocabulary/preservation/eventType/ips"
+	IngestionEndEvent                = "http://id.loc.gov/vocabulary/preservation/eventType/ine"
+	IngestionEvent                   = "http://id.loc.gov/vocabulary/preservation/eventType/ing"
+	IngestionStartEvent              = "http://id.loc.gov/vocabulary/preservation/eventType/ins"
+	MessageDigestCalculationEvent    = "http://id.loc.gov/vocabulary/preservation/eventType/mes"
+	MetadataExtractionEvent          = "http://id.loc.gov/vocabulary/preservation/eventType/met"
+	MetadataModificationEvent        = "http://id.loc.gov/vocabulary/preservation/eventType/mem"
+	MigrationEvent                   = "http://id.loc.gov/vocabulary/preservation/eventType/mig"
+	ModificationEvent                = "http://id.loc.gov/vocabulary/preservation/eventType/mod"
+	NormalizationEvent               = "http://id.loc.gov/vocabulary/preservation/eventType/nor"
+	PackingEvent                     = "http://id.loc.gov/vocabulary/preservation/eventType/pac"
+	PolicyAssignmentEvent            = "http://id.loc.gov/vocabulary/preservation/eventType/pol"
+	PrintingEvent                    = "http://id.loc.gov/vocabulary/preservation/eventType/pri"
+	QuarantineEvent                  = "http://id.loc.gov/vocabulary/preservation/eventType/qua"
+	RecoveryEvent                    = "http://id.loc.gov/vocabulary/preservation/eventType/rec"
+	RedactionEvent                   = "http://id.loc.gov/vocabulary/preservation/eventType/red"
+	RefreshmentEvent                 = "http://id.loc.gov/vocabulary/preservation/eventType/ref"
+	RenderingEvent                   = "http://id.loc.gov/vocabulary/preservation/eventType/ren"
+	ReplicationEvent                 = "http://id.loc.gov/vocabulary/preservation/eventType/rep"
+	TransferEvent                    = "http://id.loc.gov/vocabulary/preservation/eventType/tra"
+	UnpackingEvent                   = "http://id.loc.gov/vocabulary/preservation/eventType/unp"
+	UnquarantineEvent                = "http://id.loc.gov/vocabulary/preservation/eventType/unq"
+	ValidationEvent                  = "http://id.loc.gov/vocabulary/preservation/eventType/val"
+	VirusCheckEvent                  = "http://id.loc.gov/vocabulary/preservation/eventType/vir"
+)
+
+// Event outcomes for the Outcome field of a Log
 const (
-	ModificationEvent = "http://id.loc.gov/vocabulary/preservation/eventType/mod"
-	MigrationEvent    = "http://id.loc.gov/vocabulary/preservation/eventType/mig"
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+	OutcomeWarning = "warning"
 )
 
+// Tool is the Agent for the preservation events that the built-in actions record when a Meta's LogEvents field is set.
+// Change it to record the version of this package, or the name of the script that uses it.
+var Tool Agent = MakeSoftware("meta", "")
+
+// UnmarshalJSON makes Log a json Unmarshaller so that the Agent field is unmarshalled as an Agent
+func (l *Log) UnmarshalJSON(b []byte) error {
+	type plain Log
+	aux := struct {
+		*plain
+		Agent json.RawMessage `json:"agent"`
+	}{plain: (*plain)(l)}
+	err := json.Unmarshal(b, &aux)
+	if err != nil {
+		return err
+	}
+	l.Agent, err = unmarshalAgent(aux.Agent)
+	return err
+}
+
 // NewLog creates a *Log
 func NewLog(id int, typ string) *Log {
 	return &Log{
@@ -41,6 +122,64 @@ func NewLog(id int, typ string) *Log {
 	}
 }
 
+// NewEvent creates a *Log for an event of type typ, performed by agent, that started and ended at the given times
+func NewEvent(id int, typ string, start, end time.Time, agent Agent, detail string) *Log {
+	l := NewLog(id, typ)
+	l.Start, l.End, l.Agent, l.Detail = &start, &end, agent, detail
+	return l
+}
+
+// NewMigration creates a *Log for a migration event that generated the output files from the source files (e.g. _:v0f0)
+func NewMigration(id int, start, end time.Time, agent Agent, detail string, sources, outputs []string) *Log {
+	return NewEvent(id, MigrationEvent, start, end, agent, detail).Link(sources, outputs)
+}
+
+// SetOutcome sets a Log's outcome and a note about the outcome. It returns the Log so that calls can be chained.
+func (l *Log) SetOutcome(outcome, detail string) *Log {
+	l.Outcome, l.OutcomeDetail = outcome, detail
+	return l
+}
+
+// Link sets the files an event acted on (sources) and the files it produced (outputs) e.g. _:v0f0.
+// It returns the Log so that calls can be chained.
+func (l *Log) Link(sources, outputs []string) *Log {
+	l.Sources, l.Outputs = sources, outputs
+	return l
+}
+
+// AddLog creates a Log of the given type, appends it to the logs for an index, and returns it to be filled in.
+// The log's ID references its position in the index's logs.
+// Actions should add logs with AddLog, rather than by modifying the Logs map directly, as it is safe to use from concurrent actions.
+func (m *Meta) AddLog(index, typ string) *Log {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l := NewLog(len(m.Logs[index]), typ)
+	m.Logs[index] = append(m.Logs[index], l)
+	return l
+}
+
+// logEvent adds a preservation event performed by the Tool to the logs for an index, if the Meta's LogEvents field is set.
+// Returns the ID of the log, or an empty string if no log was added.
+func (m *Meta) logEvent(index, typ string, start, end time.Time, detail string) string {
+	if !m.LogEvents {
+		return ""
+	}
+	l := m.AddLog(index, typ)
+	l.Start, l.End, l.Detail, l.Agent = &start, &end, detail, Tool
+	return l.ID
+}
+
+// logFailure adds a Log, with a failure outcome, for an event that failed for the source file (e.g. _:v0f0), if the Meta's LogEvents field is set
+func (m *Meta) logFailure(index, typ string, start time.Time, detail, source string, err error) {
+	if !m.LogEvents {
+		return
+	}
+	end := time.Now()
+	l := m.AddLog(index, typ)
+	l.Start, l.End, l.Detail, l.Agent = &start, &end, detail, Tool
+	l.SetOutcome(OutcomeFailure, err.Error()).Link([]string{source}, nil)
+}
+
 // ReferenceLog makes a temporary reference to a log event.
 // This reference is swapped for a UUID by the migrate tool.
 func ReferenceLog(i int) string {
@@ -57,8 +196,18 @@ var logContext = Context{
 		ID:  "http://www.w3.org/ns/prov#endedAtTime",
 		Typ: "http://www.w3.org/2001/XMLSchema#dateTime",
 	},
-	"name":            "http://schema.org/name",
+	"name": "http://schema.org/name",
+	"output": Obj{
+		ID:  "http://www.w3.org/ns/prov#generated",
+		Typ: "@id",
+	},
+	"outcome":         "http://www.loc.gov/premis/rdf/v3/outcome",
+	"outcomeDetail":   "http://www.loc.gov/premis/rdf/v3/outcomeNote",
 	"softwareVersion": "http://schema.org/softwareVersion",
+	"source": Obj{
+		ID:  "http://www.w3.org/ns/prov#used",
+		Typ: "@id",
+	},
 	"startTime": Obj{
 		ID:  "http://www.w3.org/ns/prov#startedAtTime",
 		Typ: "http://www.w3.org/2001/XMLSchema#dateTime",
@@ -15,6 +15,8 @@
 package meta
 
 import (
+	"io/ioutil"
+	"os"
 	"path/filepath"
 	"testing"
 )
@@ -48,3 +50,67 @@ func TestLogConst(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestLogEvents(t *testing.T) {
+	src, err := ioutil.TempDir("", "meta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+	dst, err := ioutil.TempDir("", "meta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dst)
+	if err = ioutil.WriteFile(filepath.Join(src, "hello.txt"), []byte("hello world"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	m := testMeta(2)
+	m.LogEvents = true
+	m.Manifest["object0"].AddVersion([]File{{Name: "hello.txt", Size: 11}})
+	pathfunc := func(m *Meta, index string) string { return src }
+	if err = m.Output(dst, ManifestCopy(pathfunc, MD5)); err != nil {
+		t.Fatal(err)
+	}
+	logs := m.Logs["object0"]
+	if len(logs) != 2 || logs[0].Typ != ReplicationEvent || logs[1].Typ != MessageDigestCalculationEvent {
+		t.Fatalf("Expecting replication and message digest calculation events, got %v", logs)
+	}
+	if logs[0].Start == nil || logs[0].End == nil || logs[0].Agent != Tool || logs[1].Detail != "Calculated md5 hashes for 1 files" {
+		t.Errorf("Unexpected log %v", logs[1])
+	}
+	if _, err = os.Stat(filepath.Join(dst, "0", "logs", "1.json")); err != nil {
+		t.Errorf("Expecting logs to be output, got %v", err)
+	}
+	if len(m.Logs["object1"]) != 0 {
+		t.Errorf("Expecting no events for an object with no files, got %v", m.Logs["object1"])
+	}
+	// simple manifest identifies formats by extension
+	m = testMeta(1)
+	m.LogEvents = true
+	if err = SimpleManifest(map[string][2]string{"txt": {"x-fmt/111", "text/plain"}}, "")(m, filepath.Join(dst, "0"), "object0"); err != nil {
+		t.Fatal(err)
+	}
+	logs = m.Logs["object0"]
+	if len(logs) != 1 || logs[0].Typ != FormatIdentificationEvent || logs[0].Detail != "Identified the formats of 1 files by file extension" {
+		t.Errorf("Expecting a format identification event, got %v", logs)
+	}
+}
+
+func TestNewMigration(t *testing.T) {
+	start, end := *NewDateTime("2015-04-20T17:41:48+10:00"), *NewDateTime("2015-04-20T17:42:00+10:00")
+	l := NewMigration(0, start, end, MakeSoftware("LibreOffice", "6.0"), "Converted a.doc to a.pdf", []string{"_:v0f0"}, []string{"_:v1f0"})
+	l.SetOutcome("success", "converted with no warnings")
+	if l.Typ != MigrationEvent || !l.Start.Equal(start) || !l.End.Equal(end) || l.Sources[0] != "_:v0f0" || l.Outputs[0] != "_:v1f0" {
+		t.Fatalf("Unexpected log %v", l)
+	}
+	ctx, err := populate(logContext, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, term := range []string{"source", "output", "outcome", "outcomeDetail", "softwareVersion"} {
+		if _, ok := ctx[term]; !ok {
+			t.Errorf("Expecting %s in the log's context", term)
+		}
+	}
+}
@@ -15,8 +15,11 @@
 package meta
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -42,6 +45,29 @@ type AccessRule struct {
 	Text         VarStr  `json:"textTarget,omitempty"`
 }
 
+// UnmarshalJSON makes AccessRule a json Unmarshaller so that display, preview and text targets are unmarshalled as VarStrs
+func (ar *AccessRule) UnmarshalJSON(b []byte) error {
+	type plain AccessRule
+	aux := struct {
+		*plain
+		Display json.RawMessage `json:"displayTarget"`
+		Preview json.RawMessage `json:"previewTarget"`
+		Text    json.RawMessage `json:"textTarget"`
+	}{plain: (*plain)(ar)}
+	err := json.Unmarshal(b, &aux)
+	if err != nil {
+		return err
+	}
+	if ar.Display, err = unmarshalVarStr(aux.Display); err != nil {
+		return err
+	}
+	if ar.Preview, err = unmarshalVarStr(aux.Preview); err != nil {
+		return err
+	}
+	ar.Text, err = unmarshalVarStr(aux.Text)
+	return err
+}
+
 // Basis is a json basis
 type Basis struct {
 	AccessDirection   string `json:"accessDirection"`
@@ -56,6 +82,8 @@ type Version struct {
 	GeneratedBy    string   `json:"generatedBy,omitempty"`
 	HasAccessRules []string `json:"hasAccessRules,omitempty"`
 	Files          []File   `json:"files"`
+	rendition      bool     // set by actions that add renditions of another version (e.g. ExtractText), see sourceVersion
+	listed         bool     // set for archive members listed by the Siegfried loader, which aren't on disk until unpacked by Decompress
 }
 
 // File represents files
@@ -69,6 +97,8 @@ type File struct {
 	MIME           string     `json:"mime,omitempty"`
 	PUID           string     `json:"puid,omitempty"`
 	Hash           *Hash      `json:"hash,omitempty"`
+	Hashes         []Hash     `json:"hashes,omitempty"` // any further hashes, when a file is hashed with more than one algorithm
+	IsPartOf       string     `json:"isPartOf,omitempty"` // the file this file is part of e.g. the message (_:v0f0) of an email attachment
 	HasAccessRules []string   `json:"hasAccessRules,omitempty"`
 }
 
@@ -211,6 +241,37 @@ func (ft FileTarget) String() string {
 	)
 }
 
+// ParseFileTarget parses an internal reference string for a file (e.g. _:v1f2) into a FileTarget
+func ParseFileTarget(ref string) (FileTarget, error) {
+	var ft FileTarget
+	idx := strings.Index(ref, "f")
+	if !strings.HasPrefix(ref, "_:v") || idx < 0 {
+		return ft, fmt.Errorf("meta: invalid file reference %s", ref)
+	}
+	v, err := strconv.Atoi(ref[3:idx])
+	if err != nil {
+		return ft, fmt.Errorf("meta: invalid file reference %s", ref)
+	}
+	f, err := strconv.Atoi(ref[idx+1:])
+	if err != nil {
+		return ft, fmt.Errorf("meta: invalid file reference %s", ref)
+	}
+	ft[0], ft[1] = v, f
+	if v < 0 || f < 0 || ft.String() != ref {
+		return ft, fmt.Errorf("meta: invalid file reference %s", ref)
+	}
+	return ft, nil
+}
+
+// ParseVersion parses an internal reference string for a version (e.g. _:v1) into the version's index
+func ParseVersion(ref string) (int, error) {
+	v, err := strconv.Atoi(strings.TrimPrefix(ref, "_:v"))
+	if err != nil || v < 0 || ReferenceVersion(v) != ref {
+		return 0, fmt.Errorf("meta: invalid version reference %s", ref)
+	}
+	return v, nil
+}
+
 func ReferenceVersion(v int) string {
 	return ReferenceN(Ref{"v", v})
 }
@@ -278,7 +339,15 @@ var manifestContext = Context{
 	},
 	"hash":          "http://www.semanticdesktop.org/ontologies/2007/03/22/nfo#hasHash",
 	"hashAlgorithm": "http://www.semanticdesktop.org/ontologies/2007/03/22/nfo#hashAlgorithm",
-	"hashValue":     "http://www.semanticdesktop.org/ontologies/2007/03/22/nfo#hashValue",
+	"hashes": Obj{
+		ID:        "http://www.semanticdesktop.org/ontologies/2007/03/22/nfo#hasHash",
+		Container: "@set",
+	},
+	"hashValue": "http://www.semanticdesktop.org/ontologies/2007/03/22/nfo#hashValue",
+	"isPartOf": Obj{
+		ID:  "http://purl.org/dc/terms/isPartOf",
+		Typ: "@id",
+	},
 	"mime": Obj{
 		ID:  "http://purl.org/dc/terms/format",
 		Typ: "http://purl.org/dc/terms/MediaType",
@@ -22,10 +22,14 @@ package meta
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 )
 
 // marshal marshals JSON as bytes, setting and indent and turning HTML escaping off
@@ -41,14 +45,23 @@ func marshal(v interface{}) ([]byte, error) {
 // Meta is a set of metadata (metadata.json and manifest.json)
 // The Index field provides ordering.
 // The Store field can be used to store arbitrary data needed for particular projects.
+// Set the Resume field to restart an Output run that failed part way through (see Output).
+// Set the CollectErrors field to record failures for individual objects and continue rather than stopping at the first error (see Fail).
+// Set the LogEvents field to have the built-in actions (ManifestCopy, SimpleManifest and Decompress) record what they do as preservation events in the Logs.
 type Meta struct {
-	SampleOff int
-	SampleSz  int // sample size (-1 if doing a full run)
-	Index     []string
-	Metadata  map[string]*Metadata
-	Manifest  map[string]*Manifest
-	Logs      map[string][]*Log
-	Store     map[string]interface{}
+	SampleOff     int
+	SampleSz      int // sample size (-1 if doing a full run)
+	Resume        bool
+	CollectErrors bool
+	LogEvents     bool
+	Index         []string
+	Metadata      map[string]*Metadata
+	Manifest      map[string]*Manifest
+	Logs          map[string][]*Log
+	Store         map[string]interface{}
+
+	mu       sync.Mutex
+	failures Failures
 }
 
 // Cap defines the capacity of the index slice. Edit for large jobs to an approximate number of objects
@@ -67,105 +80,334 @@ func New(loaders ...Loader) (*Meta, error) {
 	return NewSample(0, -1, loaders...)
 }
 
+// NewCollect creates a new meta from the supplied loaders with the CollectErrors field set.
+// Loading continues after loader errors. If any failures are recorded, the meta is returned along with a Failures error.
+func NewCollect(loaders ...Loader) (*Meta, error) {
+	m := newMeta(0, -1)
+	m.CollectErrors = true
+	return m.load(loaders)
+}
+
 // New Sample creates a new meta from the supplied loaders.
 // For testing provide an offset where you'd like the sample to start e.g. 50 and a sample size e.g. 10.
 // If a negative offset is provided then the offset will be calculated from the end. I.e. -10 will return the final 10.
 func NewSample(offset, sample int, loaders ...Loader) (*Meta, error) {
-	m := &Meta{
-		offset,
-		sample,
-		make([]string, 0, Cap),
-		make(map[string]*Metadata),
-		make(map[string]*Manifest),
-		make(map[string][]*Log),
-		make(map[string]interface{})}
+	return newMeta(offset, sample).load(loaders)
+}
+
+func newMeta(offset, sample int) *Meta {
+	return &Meta{
+		SampleOff: offset,
+		SampleSz:  sample,
+		Index:     make([]string, 0, Cap),
+		Metadata:  make(map[string]*Metadata),
+		Manifest:  make(map[string]*Manifest),
+		Logs:      make(map[string][]*Log),
+		Store:     make(map[string]interface{}),
+	}
+}
+
+func (m *Meta) load(loaders []Loader) (*Meta, error) {
 	for _, l := range loaders {
-		if err := l.Load(m); err != nil {
+		if err := m.Fail("", loaderName(l), l.Load(m)); err != nil {
 			return nil, err
 		}
 	}
+	if fs := m.Failed(); len(fs) > 0 {
+		return m, fs
+	}
 	return m, nil
 }
 
 // Output generates metadata.json and manifest.json files for all of a Meta's metadata.
 // Arbitrary actions based on that data can also be called by this function.
 // Target is the target output directory.
+//
+// While running, Output records each object it completes in a checkpoint journal in the target directory.
+// The journal is removed once all objects are output successfully.
+// If a run fails, load a new Meta (e.g. by calling New with the same loaders), set its Resume field and call Output again
+// with the same target: completed objects are skipped and any partially written directories are removed and re-done.
+// Don't resume with the Meta from the failed run, as its actions may already have changed it (e.g. by adding versions or logs).
+//
+// If the Meta's CollectErrors field is set, objects that fail are recorded and processing continues.
+// A report of all failures (including any recorded while loading) is written to the target directory
+// and a Failures error is returned. The checkpoint journal is kept so that a resumed run re-does only the failed objects.
 func (m *Meta) Output(target string, actions ...Action) error {
+	j, err := openJournal(target, m.Resume)
+	if err != nil {
+		return err
+	}
+	for _, i := range m.sampled() {
+		if err := m.checkpoint(j, target, i, actions); err != nil {
+			j.close()
+			return err
+		}
+	}
+	return m.finish(j, target)
+}
+
+// OutputConcurrent is like Output but processes objects in parallel using a pool of workers.
+// Output directories are numbered by the objects' positions in the Index, just as they are for Output.
+// Actions must be safe to run concurrently for different indexes. Actions that aren't (e.g. because they
+// share state between calls) should be wrapped with Serial.
+// Because actions may not add to the Meta's maps concurrently, a new Manifest is created for any
+// index that doesn't have one before processing begins.
+// Processing stops at the first error. Runs can be resumed in the same way as for Output.
+func (m *Meta) OutputConcurrent(target string, workers int, actions ...Action) error {
+	if workers < 1 {
+		workers = 1
+	}
+	j, err := openJournal(target, m.Resume)
+	if err != nil {
+		return err
+	}
+	for _, v := range m.Index {
+		if _, ok := m.Manifest[v]; !ok {
+			m.Manifest[v] = NewManifest()
+		}
+	}
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	jobs := make(chan int)
+	done := make(chan struct{})
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if err := m.checkpoint(j, target, i, actions); err != nil {
+					once.Do(func() {
+						firstErr = err
+						close(done)
+					})
+				}
+			}
+		}()
+	}
+dispatch:
+	for _, i := range m.sampled() {
+		select {
+		case jobs <- i:
+		case <-done:
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if firstErr != nil {
+		j.close()
+		return firstErr
+	}
+	return m.finish(j, target)
+}
+
+// finish completes an output run. If failures have been recorded, a report is written and the checkpoint journal is kept.
+func (m *Meta) finish(j *journal, target string) error {
+	fs := m.Failed()
+	if len(fs) == 0 {
+		return j.finish()
+	}
+	j.close()
+	if err := fs.WriteReport(filepath.Join(target, ReportFile)); err != nil {
+		return err
+	}
+	return fs
+}
+
+// Serial wraps an Action that isn't safe to run concurrently (e.g. because it shares state between calls)
+// so that only one call to it runs at a time when used with OutputConcurrent.
+func Serial(a Action) Action {
+	var mu sync.Mutex
+	name := actionName(a)
+	return func(meta *Meta, target, index string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		err := a(meta, target, index)
+		if _, ok := err.(actionError); err == nil || ok {
+			return err
+		}
+		return actionError{name, err}
+	}
+}
+
+// sampled returns the positions in the Index that should be output, taking into account sample offset and size
+func (m *Meta) sampled() []int {
 	index, sample := m.SampleOff, m.SampleSz
 	if m.SampleOff < 0 && m.SampleOff > 0-len(m.Index) {
 		index = len(m.Index) + m.SampleOff
 	}
-	for i, v := range m.Index {
+	ret := make([]int, 0, len(m.Index))
+	for i := range m.Index {
 		if i < index {
 			continue
 		}
 		if sample == 0 {
-			return nil
+			break
 		}
 		sample--
-		// make the output directory, which is an incrementing integer
-		out := filepath.Join(target, strconv.Itoa(i))
-		err := os.MkdirAll(out, os.ModePerm)
-		if err != nil {
-			return err
-		}
-		// execute the actions
-		for _, a := range actions {
-			if err := a(m, out, v); err != nil {
-				return err
-			}
+		ret = append(ret, i)
+	}
+	return ret
+}
+
+// output executes the actions and writes the metadata.json, manifest.json and log files for the object at position i in the Index.
+// If an error occurs, the name of the action or output step that failed is returned along with the error.
+func (m *Meta) output(target string, i int, actions []Action) (string, error) {
+	v := m.Index[i]
+	// make the output directory, which is an incrementing integer
+	out := filepath.Join(target, strconv.Itoa(i))
+	err := os.MkdirAll(out, os.ModePerm)
+	if err != nil {
+		return "output", err
+	}
+	// execute the actions
+	for _, a := range actions {
+		if err := a(m, out, v); err != nil {
+			return failedAction(a, err)
 		}
-		meta, man := m.Metadata[v], m.Manifest[v]
-		// create metadata.json
-		ctx, err := populate(metadataContext, meta)
+	}
+	meta, man := m.Metadata[v], m.Manifest[v]
+	// create metadata.json
+	ctx, err := populate(metadataContext, meta)
+	if err != nil {
+		return "output", err
+	}
+	meta.Context = ctx
+	j, err := marshal(meta)
+	if err != nil {
+		return "output", err
+	}
+	if err = ioutil.WriteFile(filepath.Join(out, "metadata.json"), j, os.ModePerm); err != nil {
+		return "output", err
+	}
+	// create manifest.json
+	ctx, err = populate(manifestContext, man)
+	if err != nil {
+		return "output", err
+	}
+	man.Context = ctx
+	j, err = marshal(man)
+	if err != nil {
+		return "output", err
+	}
+	if err = ioutil.WriteFile(filepath.Join(out, "manifest.json"), j, os.ModePerm); err != nil {
+		return "output", err
+	}
+	// create logs
+	m.mu.Lock()
+	logs, ok := m.Logs[v]
+	m.mu.Unlock()
+	if !ok {
+		return "", nil
+	}
+	logdir := filepath.Join(out, "logs")
+	err = os.MkdirAll(logdir, os.ModePerm)
+	if err != nil {
+		return "output", err
+	}
+	for ii, log := range logs {
+		ctx, err = populate(logContext, log)
 		if err != nil {
-			return err
+			return "output", err
 		}
-		meta.Context = ctx
-		j, err := marshal(meta)
+		log.Context = ctx
+		j, err = marshal(log)
 		if err != nil {
-			return err
+			return "output", err
 		}
-		if err = ioutil.WriteFile(filepath.Join(out, "metadata.json"), j, os.ModePerm); err != nil {
-			return err
+		if err = ioutil.WriteFile(filepath.Join(logdir, strconv.Itoa(ii)+".json"), j, os.ModePerm); err != nil {
+			return "output", err
 		}
-		// create manifest.json
-		ctx, err = populate(manifestContext, man)
-		if err != nil {
-			return err
-		}
-		man.Context = ctx
-		j, err = marshal(man)
-		if err != nil {
-			return err
+	}
+	return "", nil
+}
+
+// ReadSIP reads the metadata.json, manifest.json and json log files within a SIP directory generated by Output.
+// Logs are returned in the numeric order of their file names (0.json, 1.json...).
+func ReadSIP(dir string) (*Metadata, *Manifest, []*Log, error) {
+	met, man := &Metadata{}, &Manifest{}
+	if err := readJSON(filepath.Join(dir, "metadata.json"), met); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := readJSON(filepath.Join(dir, "manifest.json"), man); err != nil {
+		return nil, nil, nil, err
+	}
+	logdir := filepath.Join(dir, "logs")
+	names, err := numbered(logdir, false)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return met, man, nil, nil
 		}
-		if err = ioutil.WriteFile(filepath.Join(out, "manifest.json"), j, os.ModePerm); err != nil {
-			return err
+		return nil, nil, nil, err
+	}
+	logs := make([]*Log, 0, len(names))
+	for _, name := range names {
+		log := &Log{}
+		if err = readJSON(filepath.Join(logdir, name+".json"), log); err != nil {
+			return nil, nil, nil, err
 		}
-		// create logs
-		logs, ok := m.Logs[v]
-		if !ok {
+		logs = append(logs, log)
+	}
+	return met, man, logs, nil
+}
+
+// readJSON reads and unmarshals the json file at path into v
+func readJSON(path string, v interface{}) error {
+	byts, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(byts, v); err != nil {
+		return fmt.Errorf("meta: error reading %s: %v", path, err)
+	}
+	return nil
+}
+
+// ListSIPs returns the paths of the numbered SIP directories (0, 1, 2...) within an output directory generated by Output.
+// Paths are returned in numeric order.
+func ListSIPs(dir string) ([]string, error) {
+	names, err := numbered(dir, true)
+	if err != nil {
+		return nil, err
+	}
+	for i, name := range names {
+		names[i] = filepath.Join(dir, name)
+	}
+	return names, nil
+}
+
+// numbered lists the entries in dir that are named with an integer (directories if dirs is true, otherwise .json files).
+// Names are returned without any extension and are sorted in numeric order.
+func numbered(dir string, dirs bool) ([]string, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	nums := make([]int, 0, len(infos))
+	for _, info := range infos {
+		if info.IsDir() != dirs {
 			continue
 		}
-		logdir := filepath.Join(out, "logs")
-		err = os.MkdirAll(logdir, os.ModePerm)
-		if err != nil {
-			return err
-		}
-		for ii, log := range logs {
-			ctx, err = populate(logContext, log)
-			if err != nil {
-				return err
-			}
-			log.Context = ctx
-			j, err = marshal(log)
-			if err != nil {
-				return err
-			}
-			if err = ioutil.WriteFile(filepath.Join(logdir, strconv.Itoa(ii)+".json"), j, os.ModePerm); err != nil {
-				return err
+		name := info.Name()
+		if !dirs {
+			if filepath.Ext(name) != ".json" {
+				continue
 			}
+			name = strings.TrimSuffix(name, ".json")
+		}
+		n, err := strconv.Atoi(name)
+		if err != nil || n < 0 || strconv.Itoa(n) != name {
+			continue
 		}
+		nums = append(nums, n)
 	}
-	return nil
+	sort.Ints(nums)
+	ret := make([]string, len(nums))
+	for i, n := range nums {
+		ret[i] = strconv.Itoa(n)
+	}
+	return ret, nil
 }
@@ -0,0 +1,75 @@
+// Copyright 2018 State of New South Wales through the State Archives and Records Authority of NSW
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package meta
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func testMeta(n int) *Meta {
+	m, _ := New()
+	for i := 0; i < n; i++ {
+		idx := "object" + strconv.Itoa(i)
+		m.Index = append(m.Index, idx)
+		m.Metadata[idx] = NewMetadata(i, idx)
+		m.Manifest[idx] = NewManifest()
+	}
+	return m
+}
+
+func TestOutputConcurrent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "meta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	m := testMeta(20)
+	var count int
+	counter := Serial(func(m *Meta, target, index string) error {
+		count++
+		return nil
+	})
+	if err = m.OutputConcurrent(dir, 4, counter, Progress(100)); err != nil {
+		t.Fatal(err)
+	}
+	if count != 20 {
+		t.Errorf("Expecting 20 objects to be processed, got %d", count)
+	}
+	n, err := New(SIPDir(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, idx := range n.Index {
+		if n.Metadata[idx].Title != "object"+strconv.Itoa(i) {
+			t.Errorf("Expecting SIP %d to have title object%d, got %s", i, i, n.Metadata[idx].Title)
+		}
+	}
+	// errors stop processing
+	fail := errors.New("fail")
+	err = m.OutputConcurrent(filepath.Join(dir, "fail"), 4, func(m *Meta, target, index string) error {
+		if index == "object5" {
+			return fail
+		}
+		return nil
+	})
+	if err != fail {
+		t.Errorf("Expecting error from action, got %v", err)
+	}
+}
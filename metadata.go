@@ -14,6 +14,11 @@
 
 package meta
 
+import (
+	"bytes"
+	"encoding/json"
+)
+
 // Metadata represents a metadata.json file
 type Metadata struct {
 	ID                string    `json:"@id"`
@@ -22,6 +27,7 @@ type Metadata struct {
 	Title             string    `json:"title"`
 	Description       string    `json:"description,omitempty"`
 	Creator           Agent     `json:"creator,omitempty"`
+	Recipient         Agent     `json:"recipient,omitempty"` // recipients of correspondence e.g. email
 	Created           *W3CDate  `json:"created,omitempty"`
 	Modified          *W3CDate  `json:"modified,omitempty"`
 	AgencyID          string    `json:"agencyIdentifier,omitempty"` // original @id used within agency e.g. TRANS.01.01
@@ -43,9 +49,81 @@ type Metadata struct {
 	Context           Context   `json:"@context"`
 }
 
+// UnmarshalJSON makes Metadata a json Unmarshaller.
+// The polymorphic fields (VarStrs, Agents, Containers, Disposals and Things) are unmarshalled into the types
+// used to build them (e.g. strings, slices of strings, Objs, DisposalRules and Businesses) rather than generic maps.
+func (m *Metadata) UnmarshalJSON(b []byte) error {
+	type plain Metadata
+	aux := struct {
+		*plain
+		Typ               json.RawMessage `json:"@type"`
+		Creator           json.RawMessage `json:"creator"`
+		Recipient         json.RawMessage `json:"recipient"`
+		Source            json.RawMessage `json:"source"`
+		IsPartOf          json.RawMessage `json:"isPartOf"`
+		DisposalRule      json.RawMessage `json:"disposalRule"`
+		Language          json.RawMessage `json:"language"`
+		Subtitles         json.RawMessage `json:"subtitles"`
+		Director          json.RawMessage `json:"director"`
+		Actor             json.RawMessage `json:"actor"`
+		ProductionCompany json.RawMessage `json:"productionCompany"`
+		About             json.RawMessage `json:"about"`
+	}{plain: (*plain)(m)}
+	err := json.Unmarshal(b, &aux)
+	if err != nil {
+		return err
+	}
+	for _, v := range []struct {
+		raw json.RawMessage
+		vs  *VarStr
+	}{
+		{aux.Typ, &m.Typ},
+		{aux.Source, &m.Source},
+		{aux.Language, &m.Language},
+		{aux.Subtitles, &m.Subtitles},
+		{aux.Director, &m.Director},
+		{aux.Actor, &m.Actor},
+		{aux.ProductionCompany, &m.ProductionCompany},
+	} {
+		if *v.vs, err = unmarshalVarStr(v.raw); err != nil {
+			return err
+		}
+	}
+	if m.Creator, err = unmarshalAgent(aux.Creator); err != nil {
+		return err
+	}
+	if m.Recipient, err = unmarshalAgent(aux.Recipient); err != nil {
+		return err
+	}
+	if m.IsPartOf, err = unmarshalContainer(aux.IsPartOf); err != nil {
+		return err
+	}
+	if m.DisposalRule, err = unmarshalDisposal(aux.DisposalRule); err != nil {
+		return err
+	}
+	m.About, err = unmarshalThing(aux.About)
+	return err
+}
+
 // Disposal can be a single DisposalRule{} or a slice of []DisposalRule{}
 type Disposal interface{}
 
+// unmarshalDisposal unmarshals a json object or array into a DisposalRule or a slice of DisposalRules
+func unmarshalDisposal(raw json.RawMessage) (Disposal, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	if raw[0] == '[' {
+		var rules []DisposalRule
+		err := json.Unmarshal(raw, &rules)
+		return rules, err
+	}
+	var rule DisposalRule
+	err := json.Unmarshal(raw, &rule)
+	return rule, err
+}
+
 type DisposalRule struct {
 	Authority string `json:"authority"`
 	Class     string `json:"class"`
@@ -72,6 +150,21 @@ type Business struct {
 	Proprietor         Agent    `json:"proprietor,omitempty"`
 }
 
+// UnmarshalJSON makes Business a json Unmarshaller so that the Proprietor field is unmarshalled as Agents
+func (b *Business) UnmarshalJSON(byts []byte) error {
+	type plain Business
+	aux := struct {
+		*plain
+		Proprietor json.RawMessage `json:"proprietor"`
+	}{plain: (*plain)(b)}
+	err := json.Unmarshal(byts, &aux)
+	if err != nil {
+		return err
+	}
+	b.Proprietor, err = unmarshalAgent(aux.Proprietor)
+	return err
+}
+
 // NewMetadata returns a Metadata with the supplied title. It also sets the @type.
 func NewMetadata(id int, title string) *Metadata {
 	return &Metadata{
@@ -135,6 +228,7 @@ var metadataContext = Context{
 	"productionCompany":  "http://schema.org/productionCompany",
 	"proprietor":         "http://records.nsw.gov.au/terms/proprietor",
 	"provenance":         "http://purl.org/dc/terms/provenance",
+	"recipient":          "http://schema.org/recipient",
 	"registrationNumber": "http://records.nsw.gov.au/terms/registrationNumber",
 	"renewalDueDate": Obj{
 		ID:  "http://records.nsw.gov.au/terms/renewalDueDate",
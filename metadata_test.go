@@ -15,6 +15,8 @@
 package meta
 
 import (
+	"encoding/json"
+	"io/ioutil"
 	"path/filepath"
 	"testing"
 	"time"
@@ -88,3 +90,25 @@ func TestAppendAgent(t *testing.T) {
 		}
 	}
 }
+
+func TestUnmarshalMetadata(t *testing.T) {
+	byts, err := ioutil.ReadFile(filepath.Join("examples", "metadata.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &Metadata{}
+	if err = json.Unmarshal(byts, m); err != nil {
+		t.Fatal(err)
+	}
+	bus, ok := m.About.(Business)
+	if !ok {
+		t.Fatalf("Expecting about to be a Business, got %T", m.About)
+	}
+	if _, ok := bus.Proprietor.(Obj); !ok {
+		t.Errorf("Expecting proprietor to be an Obj, got %T", bus.Proprietor)
+	}
+	m.AddType("http://schema.org/Legislation")
+	if err = compare(m, "metadata.json"); err == nil {
+		t.Error("Expecting added type to change the marshalled metadata")
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2018 State of New South Wales through the State Archives and Records Authority of NSW
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package migrate swaps the placeholder references used within SIPs generated by the meta package
+// (obj:N, mig:N and log:N) for UUIDs.
+//
+// Object (obj:N) and migration (mig:N) placeholders are unique across an output directory so are given the same UUID
+// wherever they appear. Log placeholders (log:N) are numbered within each SIP so are given a UUID per SIP.
+package migrate
+
+import (
+	crand "crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"bitbucket.org/srnsw/meta"
+)
+
+// placeholders match whole json strings like "obj:1", "mig:0" and "log:12"
+var placeholders = regexp.MustCompile(`"((obj|mig|log):[0-9]+)"`)
+
+// Migrator swaps placeholder references for UUIDs.
+// The Mapping field records the UUID that each placeholder was swapped for. Log placeholders are keyed by
+// the name of their SIP directory e.g. 3/log:0.
+type Migrator struct {
+	Mapping map[string]string
+	rdr     io.Reader
+}
+
+// New returns a Migrator that generates random UUIDs
+func New() *Migrator {
+	return &Migrator{
+		Mapping: make(map[string]string),
+		rdr:     crand.Reader,
+	}
+}
+
+// NewSeeded returns a Migrator that generates UUIDs deterministically from the supplied seed.
+// Re-running a seeded Migrator over the same SIPs will produce the same UUIDs.
+func NewSeeded(seed int64) *Migrator {
+	return &Migrator{
+		Mapping: make(map[string]string),
+		rdr:     rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Dir rewrites the placeholder references in the metadata.json, manifest.json and log files of all the SIPs
+// in an output directory generated by meta's Output function.
+// SIPs are processed in numeric order so that seeded UUIDs are allocated in a stable order.
+// No files are written unless all files are read and rewritten successfully.
+func (m *Migrator) Dir(dir string) error {
+	sips, err := meta.ListSIPs(dir)
+	if err != nil {
+		return err
+	}
+	rewrites := make(map[string][]byte)
+	order := make([]string, 0, len(sips)*3)
+	for _, sip := range sips {
+		logs, err := filepath.Glob(filepath.Join(sip, "logs", "*.json"))
+		if err != nil {
+			return err
+		}
+		paths := append([]string{filepath.Join(sip, "metadata.json"), filepath.Join(sip, "manifest.json")}, logs...)
+		for _, path := range paths {
+			byts, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			byts, changed, err := m.replace(filepath.Base(sip), byts)
+			if err != nil {
+				return err
+			}
+			if changed {
+				rewrites[path] = byts
+				order = append(order, path)
+			}
+		}
+	}
+	for _, path := range order {
+		if err := ioutil.WriteFile(path, rewrites[path], os.ModePerm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replace swaps the placeholders in a json file for UUIDs, allocating new UUIDs as needed.
+// The sip argument is the name of the SIP directory and is used to key log placeholders.
+func (m *Migrator) replace(sip string, byts []byte) ([]byte, bool, error) {
+	var (
+		changed bool
+		err     error
+	)
+	ret := placeholders.ReplaceAllFunc(byts, func(match []byte) []byte {
+		if err != nil {
+			return match
+		}
+		sub := placeholders.FindSubmatch(match)
+		key := string(sub[1])
+		if string(sub[2]) == "log" {
+			key = sip + "/" + key
+		}
+		id, ok := m.Mapping[key]
+		if !ok {
+			id, err = m.uuid()
+			if err != nil {
+				return match
+			}
+			m.Mapping[key] = id
+		}
+		changed = true
+		return []byte(`"` + id + `"`)
+	})
+	return ret, changed, err
+}
+
+// uuid generates a version 4 UUID
+func (m *Migrator) uuid() (string, error) {
+	var u [16]byte
+	if _, err := io.ReadFull(m.rdr, u[:]); err != nil {
+		return "", err
+	}
+	u[6] = (u[6] & 0x0f) | 0x40 // version 4
+	u[8] = (u[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:]), nil
+}
+
+// WriteMapping writes the Migrator's mapping of placeholders to UUIDs as a json file at path
+func (m *Migrator) WriteMapping(path string) error {
+	byts, err := json.MarshalIndent(m.Mapping, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, byts, os.ModePerm)
+}
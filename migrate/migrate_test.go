@@ -0,0 +1,80 @@
+// Copyright 2018 State of New South Wales through the State Archives and Records Authority of NSW
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrate
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"bitbucket.org/srnsw/meta"
+)
+
+// copySIPs copies the example SIP's json files into a temporary directory
+func copySIPs(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "migrate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join("..", "examples", "project-0", "0")
+	for _, name := range []string{"metadata.json", "manifest.json", filepath.Join("logs", "0.json")} {
+		byts, err := ioutil.ReadFile(filepath.Join(src, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = os.MkdirAll(filepath.Dir(filepath.Join(dir, "0", name)), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(filepath.Join(dir, "0", name), byts, os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestDir(t *testing.T) {
+	dir := copySIPs(t)
+	defer os.RemoveAll(dir)
+	mig := NewSeeded(1)
+	if err := mig.Dir(dir); err != nil {
+		t.Fatal(err)
+	}
+	if len(mig.Mapping) != 3 {
+		t.Fatalf("Expecting 3 placeholders to be swapped, got %v", mig.Mapping)
+	}
+	m, err := meta.New(meta.SIPDir(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx := m.Index[0]
+	if m.Metadata[idx].ID != mig.Mapping["obj:0"] || m.Metadata[idx].Migration != mig.Mapping["mig:0"] {
+		t.Errorf("Expecting metadata @id and migration to be swapped, got %s and %s", m.Metadata[idx].ID, m.Metadata[idx].Migration)
+	}
+	if m.Manifest[idx].Versions[1].GeneratedBy != m.Logs[idx][0].ID || m.Logs[idx][0].ID != mig.Mapping["0/log:0"] {
+		t.Errorf("Expecting generatedBy to match the swapped log @id, got %s and %s", m.Manifest[idx].Versions[1].GeneratedBy, m.Logs[idx][0].ID)
+	}
+	// re-running with the same seed is reproducible
+	dir2 := copySIPs(t)
+	defer os.RemoveAll(dir2)
+	mig2 := NewSeeded(1)
+	if err := mig2.Dir(dir2); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(mig.Mapping, mig2.Mapping) {
+		t.Errorf("Expecting seeded mappings to match, got %v and %v", mig.Mapping, mig2.Mapping)
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2018 State of New South Wales through the State Archives and Records Authority of NSW
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package meta
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Converter is an external command that the Migrate action uses to convert files of a particular format.
+// In Args, "{in}" is replaced with the path to the file to convert, "{out}" with the path to write the converted file to,
+// and "{outdir}" with the folder the converted file should be written to (for converters, like LibreOffice, that name their outputs).
+// Converted files are named after the original with the Ext extension (e.g. "pdf").
+// The PUID (e.g. fmt/276) and MIME of converted files are optional.
+// Name and Version describe the converter in the migration log: Name defaults to the name of the Command.
+type Converter struct {
+	Command string
+	Args    []string
+	Ext     string
+	PUID    string
+	MIME    string
+	Name    string
+	Version string
+}
+
+func (c Converter) run(in, out string) error {
+	repl := strings.NewReplacer("{in}", in, "{out}", out, "{outdir}", filepath.Dir(out))
+	args := make([]string, len(c.Args))
+	for i, arg := range c.Args {
+		args[i] = repl.Replace(arg)
+	}
+	byt, err := exec.Command(c.Command, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("meta: %s failed to convert %s: %v %s", c.Name, in, err, strings.TrimSpace(string(byt)))
+	}
+	return nil
+}
+
+// Migrate returns an action that converts the files in the latest version of an object using external commands.
+// Converters are keyed by the PUID of the files they convert (e.g. fmt/40). Files without a converter are left out.
+// Converted files are written to the next versions/N folder and a Version, derived from the latest version, is added to the manifest.
+// The new version is generated by a migration Log, which records when the conversions started and ended, the converters used,
+// and links the original files to the converted files.
+// If a converter fails, a migration Log with a failure outcome and the converter's error is added for the file. The error
+// is handled with Fail: if the Meta's CollectErrors field is set, the file is left out of the new version and migration continues.
+// If the original files have fixity hashes, the converted files are hashed with the same algorithms.
+// Objects with no files to convert are unchanged.
+// Migrate reads files from the output, so should follow an action such as ManifestCopy.
+func Migrate(converters map[string]Converter) Action {
+	convs := make(map[string]Converter, len(converters))
+	for puid, c := range converters {
+		if c.Command == "" || c.Ext == "" {
+			panic("meta: Migrate converter for " + puid + " must have a Command and Ext")
+		}
+		if c.Name == "" {
+			c.Name = strings.TrimSuffix(filepath.Base(c.Command), filepath.Ext(c.Command))
+		}
+		convs[strings.TrimPrefix(puid, "http://www.nationalarchives.gov.uk/pronom/")] = c
+	}
+	return func(m *Meta, target, index string) error {
+		man := m.Manifest[index]
+		if len(man.Versions) == 0 {
+			return nil
+		}
+		src := man.Versions[len(man.Versions)-1]
+		srcdir := filepath.Join(target, "versions", strconv.Itoa(len(man.Versions)-1))
+		outdir := filepath.Join(target, "versions", strconv.Itoa(len(man.Versions)))
+		var (
+			start            time.Time
+			files            []File
+			details, sources []string
+			agents           []Agent
+		)
+		used, names := make(map[string]bool), make(map[string]bool)
+		for _, f := range src.Files {
+			c, ok := convs[strings.TrimPrefix(f.PUID, "http://www.nationalarchives.gov.uk/pronom/")]
+			if !ok {
+				continue
+			}
+			if start.IsZero() {
+				start = time.Now()
+			}
+			name := renamed(f.Name, "."+c.Ext, names)
+			out := filepath.Join(outdir, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(out), os.ModePerm); err != nil {
+				return err
+			}
+			fstart := time.Now()
+			if err := c.run(filepath.Join(srcdir, filepath.FromSlash(f.Name)), out); err != nil {
+				os.Remove(out) // remove any partial output
+				fend := time.Now()
+				l := m.AddLog(index, MigrationEvent)
+				l.Start, l.End, l.Agent, l.Detail = &fstart, &fend, MakeSoftware(c.Name, c.Version), "Failed to convert "+f.Name
+				l.SetOutcome(OutcomeFailure, err.Error()).Link([]string{f.ID}, nil)
+				if err = m.Fail(index, "meta.Migrate", err); err != nil {
+					return err
+				}
+				continue
+			}
+			fi, err := os.Stat(out)
+			if err != nil {
+				return fmt.Errorf("meta: %s did not create %s: %v", c.Name, name, err)
+			}
+			t := fi.ModTime().Truncate(time.Second)
+			file := File{
+				Name:     name,
+				Size:     fi.Size(),
+				Modified: &t,
+				MIME:     c.MIME,
+				PUID:     ToPUID(c.PUID),
+			}
+			var algs []string
+			for _, h := range f.AllHashes() {
+				if _, err := newHash(h.Algorithm); err == nil {
+					algs = append(algs, h.Algorithm)
+				}
+			}
+			if len(algs) > 0 {
+				hs, err := HashFile(out, algs...)
+				if err != nil {
+					return err
+				}
+				file.SetHashes(hs)
+			}
+			files = append(files, file)
+			details = append(details, f.Name+" to "+name)
+			sources = append(sources, f.ID)
+			if !used[c.Name+c.Version] {
+				used[c.Name+c.Version] = true
+				agents = append(agents, MakeSoftware(c.Name, c.Version))
+			}
+		}
+		if len(files) == 0 {
+			return nil
+		}
+		end := time.Now()
+		man.AddVersion(files)
+		outputs := make([]string, len(files))
+		for i, f := range files {
+			outputs[i] = f.ID
+		}
+		l := m.AddLog(index, MigrationEvent)
+		l.Start, l.End = &start, &end
+		l.Detail = "Converted " + strings.Join(details, "; ")
+		if len(agents) == 1 {
+			l.Agent = agents[0]
+		} else {
+			l.Agent = agents
+		}
+		l.SetOutcome(OutcomeSuccess, "").Link(sources, outputs)
+		v := &man.Versions[len(man.Versions)-1]
+		v.DerivedFrom, v.GeneratedBy = src.ID, l.ID
+		return nil
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2018 State of New South Wales through the State Archives and Records Authority of NSW
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package meta
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestHelperConvert isn't a real test: it is run as an external converter by TestMigrate.
+// It writes the contents of the file given as its first argument, in upper case, to the file given as its second.
+func TestHelperConvert(t *testing.T) {
+	if os.Getenv("META_HELPER_CONVERT") != "1" {
+		return
+	}
+	args := os.Args
+	for len(args) > 0 && args[0] != "--" {
+		args = args[1:]
+	}
+	byt, err := ioutil.ReadFile(args[1])
+	if err != nil {
+		os.Exit(1)
+	}
+	if err = ioutil.WriteFile(args[2], []byte(strings.ToUpper(string(byt))), os.ModePerm); err != nil {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func TestMigrate(t *testing.T) {
+	os.Setenv("META_HELPER_CONVERT", "1")
+	defer os.Unsetenv("META_HELPER_CONVERT")
+	target, err := ioutil.TempDir("", "meta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(target)
+	if err = os.MkdirAll(filepath.Join(target, "versions", "0"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(target, "versions", "0", "a.doc"), []byte("hello"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	m := testMeta(1)
+	m.CollectErrors = true
+	man := m.Manifest[m.Index[0]]
+	man.AddVersion([]File{
+		{Name: "a.doc", Size: 5, PUID: ToPUID("fmt/40"), Hash: &Hash{Algorithm: MD5, Value: "5d41402abc4b2a76b9719d911017c592"}},
+		{Name: "b.txt", Size: 5, PUID: ToPUID("x-fmt/111")},
+	})
+	migrate := Migrate(map[string]Converter{
+		"fmt/40": {
+			Command: os.Args[0],
+			Args:    []string{"-test.run=TestHelperConvert", "--", "{in}", "{out}"},
+			Ext:     "pdf",
+			PUID:    "fmt/276",
+			MIME:    "application/pdf",
+			Name:    "upper",
+			Version: "1.0",
+		},
+		"x-fmt/111": {
+			Command: filepath.Join(target, "missing"),
+			Ext:     "pdf",
+		},
+	})
+	if err = migrate(m, target, m.Index[0]); err != nil {
+		t.Fatal(err)
+	}
+	byt, err := ioutil.ReadFile(filepath.Join(target, "versions", "1", "a.pdf"))
+	if err != nil || string(byt) != "HELLO" {
+		t.Fatalf("Expecting converted file, got %s %v", byt, err)
+	}
+	if len(man.Versions) != 2 {
+		t.Fatalf("Expecting a new version, got %v", man.Versions)
+	}
+	v := man.Versions[1]
+	if v.DerivedFrom != "_:v0" || v.GeneratedBy != "log:1" || len(v.Files) != 1 || v.Files[0].Name != "a.pdf" || v.Files[0].Size != 5 {
+		t.Errorf("Unexpected version %v", v)
+	}
+	if h := v.Files[0].AllHashes(); len(h) != 1 || h[0].Algorithm != MD5 {
+		t.Errorf("Expecting the converted file to be hashed with md5, got %v", v.Files[0].Hash)
+	}
+	logs := m.Logs[m.Index[0]]
+	if len(logs) != 2 {
+		t.Fatalf("Expecting a failed and a successful migration log, got %v", logs)
+	}
+	if l := logs[0]; l.Outcome != OutcomeFailure || l.OutcomeDetail == "" || len(l.Sources) != 1 || l.Sources[0] != "_:v0f1" || len(l.Outputs) != 0 {
+		t.Errorf("Unexpected failure log %v", l)
+	}
+	if len(m.Failed()) != 1 {
+		t.Errorf("Expecting the failed conversion to be recorded, got %v", m.Failed())
+	}
+	l := logs[1]
+	if l.Typ != MigrationEvent || l.Start == nil || l.End == nil || l.Detail != "Converted a.doc to a.pdf" || l.Outcome != OutcomeSuccess {
+		t.Fatalf("Unexpected log %v", l)
+	}
+	if len(l.Sources) != 1 || l.Sources[0] != "_:v0f0" || len(l.Outputs) != 1 || l.Outputs[0] != "_:v1f0" {
+		t.Errorf("Unexpected linked files %v %v", l.Sources, l.Outputs)
+	}
+	if agent, ok := l.Agent.(Obj); !ok || agent.Name != "upper" || agent.SoftwareVersion != "1.0" {
+		t.Errorf("Unexpected agent %v", l.Agent)
+	}
+	if errs := ValidateManifest(m.Index[0], man, logs); errs != nil {
+		t.Error(errs)
+	}
+}
+
+func TestMigrateNames(t *testing.T) {
+	os.Setenv("META_HELPER_CONVERT", "1")
+	defer os.Unsetenv("META_HELPER_CONVERT")
+	target, err := ioutil.TempDir("", "meta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(target)
+	if err = os.MkdirAll(filepath.Join(target, "versions", "0"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"a.doc": "doc", "a.docx": "docx"} {
+		if err = ioutil.WriteFile(filepath.Join(target, "versions", "0", name), []byte(content), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := testMeta(1)
+	man := m.Manifest[m.Index[0]]
+	man.AddVersion([]File{
+		{Name: "a.doc", Size: 3, PUID: ToPUID("fmt/40")},
+		{Name: "a.docx", Size: 4, PUID: ToPUID("fmt/412")},
+	})
+	upper := Converter{
+		Command: os.Args[0],
+		Args:    []string{"-test.run=TestHelperConvert", "--", "{in}", "{out}"},
+		Ext:     "pdf",
+	}
+	if err = Migrate(map[string]Converter{"fmt/40": upper, "fmt/412": upper})(m, target, m.Index[0]); err != nil {
+		t.Fatal(err)
+	}
+	files := man.Versions[1].Files
+	if len(files) != 2 || files[0].Name != "a.pdf" || files[1].Name != "a (2).pdf" {
+		t.Fatalf("Expecting distinct names for the converted files, got %v", files)
+	}
+	for name, expect := range map[string]string{"a.pdf": "DOC", "a (2).pdf": "DOCX"} {
+		if byt, err := ioutil.ReadFile(filepath.Join(target, "versions", "1", name)); err != nil || string(byt) != expect {
+			t.Errorf("Expecting %s to contain %s, got %s %v", name, expect, byt, err)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2018 State of New South Wales through the State Archives and Records Authority of NSW
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package meta
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // register image formats for image.Decode
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/tiff"
+)
+
+// previewMIMEs are the image formats that Preview generates previews for
+var previewMIMEs = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/tiff": true,
+	"image/gif":  true,
+}
+
+// MaxPreviewPixels is the largest image, in pixels (width times height), that Preview will decode.
+// Larger images are skipped, as decoding them could use up all the available memory.
+var MaxPreviewPixels = 100 * 1000 * 1000
+
+// Preview returns an action that generates preview images for the JPEG, PNG, TIFF and GIF files in the latest version of an object,
+// skipping versions of renditions (such as the text files added by ExtractText).
+// Previews are JPEGs that fit within a square of size pixels (images that are already smaller aren't enlarged). Transparent areas are white.
+// Previews are written to the next versions/N folder (named after the original with a .jpg extension) and
+// a Version, derived from the version of the images, is added to the manifest.
+// The previews are set as the previewTarget of the object's access rules: each access rule is given the previews of the files
+// in its displayTarget or, if it has no displayTarget, all the previews.
+// If the Meta's LogEvents field is set, generating the previews is logged as a migration event which generates the new version.
+// If generating a preview fails, or an image is larger than MaxPreviewPixels, the error is handled with Fail (and, if LogEvents is set,
+// a migration Log with a failure outcome is added for the file): if the Meta's CollectErrors field is set, the image is skipped
+// and previews are generated for the object's other images.
+// Objects with no images are unchanged.
+// Preview reads files from the output, so should follow an action such as ManifestCopy.
+func Preview(size int) Action {
+	if size <= 0 {
+		panic("meta: Preview size must be greater than 0")
+	}
+	return func(m *Meta, target, index string) error {
+		man := m.Manifest[index]
+		if len(man.Versions) == 0 {
+			return nil
+		}
+		start := time.Now()
+		sidx := sourceVersion(man)
+		src := man.Versions[sidx]
+		srcdir := filepath.Join(target, "versions", strconv.Itoa(sidx))
+		outdir := filepath.Join(target, "versions", strconv.Itoa(len(man.Versions)))
+		var files []File
+		previews := make(map[string]int) // maps the IDs of source files to the index of their preview
+		names := make(map[string]bool)
+		for _, f := range src.Files {
+			if mt, _, _ := mime.ParseMediaType(f.MIME); !previewMIMEs[mt] {
+				continue
+			}
+			name := renamed(f.Name, ".jpg", names)
+			out := filepath.Join(outdir, filepath.FromSlash(name))
+			fstart := time.Now()
+			sz, err := preview(filepath.Join(srcdir, filepath.FromSlash(f.Name)), out, size)
+			if err != nil {
+				m.logFailure(index, MigrationEvent, fstart, "Failed to generate a preview of "+f.Name, f.ID, err)
+				if err = m.Fail(index, "meta.Preview", fmt.Errorf("meta: error generating a preview of %s: %v", f.Name, err)); err != nil {
+					return err
+				}
+				continue
+			}
+			t := time.Now().Truncate(time.Second)
+			previews[f.ID] = len(files)
+			files = append(files, File{
+				Name:     name,
+				Size:     sz,
+				Modified: &t,
+				MIME:     "image/jpeg",
+				PUID:     ToPUID("fmt/41"), // Raw JPEG Stream: Go's JPEG encoder doesn't add JFIF or EXIF headers
+			})
+		}
+		if len(files) == 0 {
+			return nil
+		}
+		man.AddVersion(files)
+		v := &man.Versions[len(man.Versions)-1]
+		v.DerivedFrom, v.rendition = src.ID, true
+		v.GeneratedBy = m.logEvent(index, MigrationEvent, start, time.Now(), "Generated "+strconv.Itoa(len(files))+" preview images")
+		retarget(m, index, previews, func(ar *AccessRule, v VarStr) { ar.Preview = v })
+		return nil
+	}
+}
+
+// preview writes a JPEG preview of the image at path to out, scaled to fit within size pixels, and returns its size in bytes
+func preview(path, out string, size int) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return 0, err
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > int64(MaxPreviewPixels) {
+		return 0, fmt.Errorf("image is %dx%d pixels, larger than the limit of %d pixels", cfg.Width, cfg.Height, MaxPreviewPixels)
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return 0, err
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w > size || h > size {
+		if w > h {
+			w, h = size, h*size/w
+		} else {
+			w, h = w*size/h, size
+		}
+		if w < 1 {
+			w = 1
+		}
+		if h < 1 {
+			h = 1
+		}
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Over, nil)
+	if err = os.MkdirAll(filepath.Dir(out), os.ModePerm); err != nil {
+		return 0, err
+	}
+	o, err := os.Create(out)
+	if err != nil {
+		return 0, err
+	}
+	if err = jpeg.Encode(o, dst, &jpeg.Options{Quality: 85}); err != nil {
+		o.Close()
+		return 0, err
+	}
+	fi, err := o.Stat()
+	if err != nil {
+		o.Close()
+		return 0, err
+	}
+	return fi.Size(), o.Close()
+}
@@ -0,0 +1,156 @@
+// Copyright 2018 State of New South Wales through the State Archives and Records Authority of NSW
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package meta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPreview(t *testing.T) {
+	target, err := ioutil.TempDir("", "meta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(target)
+	if err = os.MkdirAll(filepath.Join(target, "versions", "0"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, 400, 200))
+	for x := 0; x < 400; x++ {
+		img.Set(x, 100, color.NRGBA{255, 0, 0, 255})
+	}
+	f, err := os.Create(filepath.Join(target, "versions", "0", "photo.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	m := testMeta(1)
+	man := m.Manifest[m.Index[0]]
+	man.AddVersion([]File{{Name: "a.txt", MIME: "text/plain"}, {Name: "photo.png", MIME: "image/png"}})
+	man.AccessRules, _, _ = AppendAR(nil, "2016-05-23", "global", true, 0, "", nil, nil, nil)
+	if err = Preview(100)(m, target, m.Index[0]); err != nil {
+		t.Fatal(err)
+	}
+	pf, err := os.Open(filepath.Join(target, "versions", "1", "photo.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pf.Close()
+	cfg, err := jpeg.DecodeConfig(pf)
+	if err != nil || cfg.Width != 100 || cfg.Height != 50 {
+		t.Errorf("Expecting a 100x50 preview, got %v (%v)", cfg, err)
+	}
+	if len(man.Versions) != 2 || man.Versions[1].Files[0].MIME != "image/jpeg" || man.Versions[1].Files[0].Size == 0 {
+		t.Fatalf("Unexpected versions %v", man.Versions)
+	}
+	if p, ok := man.AccessRules[0].Preview.(string); !ok || p != "_:v1f0" {
+		t.Errorf("Expecting preview target to be _:v1f0, got %v", man.AccessRules[0].Preview)
+	}
+}
+
+func TestPreviewFailure(t *testing.T) {
+	target, err := ioutil.TempDir("", "meta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(target)
+	if err = os.MkdirAll(filepath.Join(target, "versions", "0"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err = png.Encode(&buf, image.NewGray(image.Rect(0, 0, 10, 10))); err != nil {
+		t.Fatal(err)
+	}
+	small := buf.Bytes()
+	// a png whose header claims it is 100000x100000 pixels
+	big := append([]byte(nil), small...)
+	binary.BigEndian.PutUint32(big[16:], 100000)
+	binary.BigEndian.PutUint32(big[20:], 100000)
+	binary.BigEndian.PutUint32(big[29:], crc32.ChecksumIEEE(big[12:29]))
+	for name, content := range map[string][]byte{"big.png": big, "bad.png": []byte("not a png"), "small.png": small} {
+		if err = ioutil.WriteFile(filepath.Join(target, "versions", "0", name), content, os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := testMeta(1)
+	m.CollectErrors = true
+	man := m.Manifest[m.Index[0]]
+	man.AddVersion([]File{{Name: "big.png", MIME: "image/png"}, {Name: "bad.png", MIME: "image/png"}, {Name: "small.png", MIME: "image/png"}})
+	if err = Preview(100)(m, target, m.Index[0]); err != nil {
+		t.Fatal(err)
+	}
+	if len(man.Versions) != 2 || len(man.Versions[1].Files) != 1 || man.Versions[1].Files[0].Name != "small.jpg" {
+		t.Fatalf("Expecting a preview of the small image only, got %v", man.Versions)
+	}
+	fs := m.Failed()
+	if len(fs) != 2 || !strings.Contains(fs[0].Err.Error(), "larger than the limit") {
+		t.Errorf("Expecting the big and bad images to fail, got %v", fs)
+	}
+}
+
+func TestRenditions(t *testing.T) {
+	target, err := ioutil.TempDir("", "meta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(target)
+	if err = os.MkdirAll(filepath.Join(target, "versions", "0"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(target, "versions", "0", "page.html"), []byte("<p>Hello</p>"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(filepath.Join(target, "versions", "0", "photo.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = png.Encode(f, image.NewNRGBA(image.Rect(0, 0, 20, 20))); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	m := testMeta(1)
+	man := m.Manifest[m.Index[0]]
+	man.AddVersion([]File{{Name: "page.html", MIME: "text/html"}, {Name: "photo.png", MIME: "image/png"}})
+	man.AccessRules, _, _ = AppendAR(nil, "2016-05-23", "global", true, 0, "", []FileTarget{{0, 0}, {0, 1}}, nil, nil)
+	// the text and previews are both renditions of the original version, whichever is generated first
+	for _, a := range []Action{ExtractText(nil), Preview(100)} {
+		if err = a(m, target, m.Index[0]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(man.Versions) != 3 || man.Versions[1].DerivedFrom != "_:v0" || man.Versions[2].DerivedFrom != "_:v0" {
+		t.Fatalf("Expecting two versions derived from the original, got %v", man.Versions)
+	}
+	if txt, ok := man.AccessRules[0].Text.(string); !ok || txt != "_:v1f0" {
+		t.Errorf("Expecting text target to be _:v1f0, got %v", man.AccessRules[0].Text)
+	}
+	if p, ok := man.AccessRules[0].Preview.(string); !ok || p != "_:v2f0" {
+		t.Errorf("Expecting preview target to be _:v2f0, got %v", man.AccessRules[0].Preview)
+	}
+}
@@ -0,0 +1,372 @@
+// Copyright 2018 State of New South Wales through the State Archives and Records Authority of NSW
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package meta
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Extractor extracts plain text from the file at path
+type Extractor func(path string) (string, error)
+
+// DefaultExtractors returns the text extractors built in to this package, keyed by MIME type.
+// These handle HTML, OOXML (docx, xlsx, pptx) and OpenDocument (odt, ods, odp) files and email messages.
+// Extracting text from PDFs needs an external tool: add PDFText to the returned map to extract text from PDFs e.g.
+//
+//	extractors := meta.DefaultExtractors()
+//	extractors["application/pdf"] = meta.PDFText("pdftotext")
+func DefaultExtractors() map[string]Extractor {
+	return map[string]Extractor{
+		"text/html":             HTMLText,
+		"application/xhtml+xml": HTMLText,
+		"application/vnd.openxmlformats-officedocument.wordprocessingml.document":   OfficeText,
+		"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         OfficeText,
+		"application/vnd.openxmlformats-officedocument.presentationml.presentation": OfficeText,
+		"application/vnd.oasis.opendocument.text":                                   OfficeText,
+		"application/vnd.oasis.opendocument.spreadsheet":                            OfficeText,
+		"application/vnd.oasis.opendocument.presentation":                           OfficeText,
+		"message/rfc822": EmailText,
+	}
+}
+
+// ExtractText returns an action that extracts plain text from the files in the latest version of an object, skipping
+// versions of renditions (such as the previews added by Preview).
+// Extractors are keyed by the MIME type of the files they handle: if nil, DefaultExtractors is used.
+// Text files are written to the next versions/N folder (named after the original with a .txt extension) and
+// a Version, derived from the version the text was extracted from, is added to the manifest.
+// The text files are set as the textTarget of the object's access rules: each access rule is given the text of the files
+// in its displayTarget or, if it has no displayTarget, all the text files.
+// If the Meta's LogEvents field is set, the extraction is logged as a migration event which generates the new version.
+// If extracting text from a file fails, the error is handled with Fail (and, if LogEvents is set, a migration Log with a
+// failure outcome is added for the file): if the Meta's CollectErrors field is set, the file is skipped and extraction continues.
+// Objects with no files to extract text from are unchanged.
+// ExtractText reads files from the output, so should follow an action such as ManifestCopy.
+func ExtractText(extractors map[string]Extractor) Action {
+	if extractors == nil {
+		extractors = DefaultExtractors()
+	}
+	return func(m *Meta, target, index string) error {
+		man := m.Manifest[index]
+		if len(man.Versions) == 0 {
+			return nil
+		}
+		start := time.Now()
+		sidx := sourceVersion(man)
+		src := man.Versions[sidx]
+		srcdir := filepath.Join(target, "versions", strconv.Itoa(sidx))
+		outdir := filepath.Join(target, "versions", strconv.Itoa(len(man.Versions)))
+		var files []File
+		texts := make(map[string]int) // maps the IDs of source files to the index of their text file
+		names := make(map[string]bool)
+		for _, f := range src.Files {
+			mt, _, _ := mime.ParseMediaType(f.MIME)
+			extract, ok := extractors[mt]
+			if !ok {
+				continue
+			}
+			fstart := time.Now()
+			text, err := extract(filepath.Join(srcdir, filepath.FromSlash(f.Name)))
+			if err != nil {
+				m.logFailure(index, MigrationEvent, fstart, "Failed to extract text from "+f.Name, f.ID, err)
+				if err = m.Fail(index, "meta.ExtractText", fmt.Errorf("meta: error extracting text from %s: %v", f.Name, err)); err != nil {
+					return err
+				}
+				continue
+			}
+			name := renamed(f.Name, ".txt", names)
+			out := filepath.Join(outdir, filepath.FromSlash(name))
+			if err = os.MkdirAll(filepath.Dir(out), os.ModePerm); err != nil {
+				return err
+			}
+			if err = ioutil.WriteFile(out, []byte(text), os.ModePerm); err != nil {
+				return err
+			}
+			t := time.Now().Truncate(time.Second)
+			texts[f.ID] = len(files)
+			files = append(files, File{
+				Name:     name,
+				Size:     int64(len(text)),
+				Modified: &t,
+				MIME:     "text/plain",
+				PUID:     ToPUID("x-fmt/111"),
+			})
+		}
+		if len(files) == 0 {
+			return nil
+		}
+		man.AddVersion(files)
+		v := &man.Versions[len(man.Versions)-1]
+		v.DerivedFrom, v.rendition = src.ID, true
+		v.GeneratedBy = m.logEvent(index, MigrationEvent, start, time.Now(), "Extracted text from "+strconv.Itoa(len(files))+" files")
+		retarget(m, index, texts, func(ar *AccessRule, v VarStr) { ar.Text = v })
+		return nil
+	}
+}
+
+// PDFText returns an Extractor that extracts text from PDFs with pdftotext (from Poppler or Xpdf).
+// The command is the name of, or path to, the pdftotext executable.
+func PDFText(command string) Extractor {
+	return func(path string) (string, error) {
+		var stderr bytes.Buffer
+		cmd := exec.Command(command, "-enc", "UTF-8", path, "-")
+		cmd.Stderr = &stderr
+		byt, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("%v %s", err, strings.TrimSpace(stderr.String()))
+		}
+		return string(byt), nil
+	}
+}
+
+// HTMLText is an Extractor for HTML files. It drops tags, comments, scripts and styles and unescapes entities.
+func HTMLText(path string) (string, error) {
+	byt, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return htmlText(string(byt)), nil
+}
+
+// blockTags are the HTML elements that start a new line of text
+var blockTags = map[string]bool{
+	"p": true, "br": true, "div": true, "li": true, "tr": true, "h1": true, "h2": true, "h3": true,
+	"h4": true, "h5": true, "h6": true, "title": true, "table": true, "ul": true, "ol": true, "blockquote": true,
+}
+
+func htmlText(s string) string {
+	var buf bytes.Buffer
+	for len(s) > 0 {
+		lt := strings.Index(s, "<")
+		if lt < 0 {
+			buf.WriteString(html.UnescapeString(s))
+			break
+		}
+		buf.WriteString(html.UnescapeString(s[:lt]))
+		s = s[lt:]
+		if strings.HasPrefix(s, "<!--") {
+			end := strings.Index(s, "-->")
+			if end < 0 {
+				break
+			}
+			s = s[end+3:]
+			continue
+		}
+		gt := strings.Index(s, ">")
+		if gt < 0 {
+			break
+		}
+		closing := strings.HasPrefix(s, "</")
+		tag := strings.ToLower(strings.TrimLeft(s[1:gt], "/"))
+		if idx := strings.IndexAny(tag, " \t\r\n/"); idx >= 0 {
+			tag = tag[:idx]
+		}
+		s = s[gt+1:]
+		if (tag == "script" || tag == "style") && !closing {
+			// skip to the closing tag
+			end := strings.Index(strings.ToLower(s), "</"+tag)
+			if end < 0 {
+				break
+			}
+			s = s[end:]
+			continue
+		}
+		if blockTags[tag] {
+			buf.WriteString("\n")
+		}
+	}
+	return tidy(buf.String())
+}
+
+// tidy collapses the whitespace within lines of text and drops empty lines
+func tidy(s string) string {
+	lines := strings.Split(s, "\n")
+	ret := make([]string, 0, len(lines))
+	for _, l := range lines {
+		if l = strings.Join(strings.Fields(l), " "); l != "" {
+			ret = append(ret, l)
+		}
+	}
+	return strings.Join(ret, "\n")
+}
+
+// OfficeText is an Extractor for OOXML (docx, xlsx, pptx) and OpenDocument (odt, ods, odp) files
+func OfficeText(path string) (string, error) {
+	rdr, err := zip.OpenReader(path)
+	if err != nil {
+		return "", err
+	}
+	defer rdr.Close()
+	var parts []*zip.File
+	for _, f := range rdr.File {
+		switch {
+		case f.Name == "word/document.xml", f.Name == "xl/sharedStrings.xml", f.Name == "content.xml":
+			parts = append(parts, f)
+		case strings.HasPrefix(f.Name, "ppt/slides/slide") && strings.HasSuffix(f.Name, ".xml"):
+			parts = append(parts, f)
+		}
+	}
+	if len(parts) == 0 {
+		return "", fmt.Errorf("no document content in %s", filepath.Base(path))
+	}
+	// put slides in numeric order (slide2.xml before slide10.xml)
+	sort.SliceStable(parts, func(i, j int) bool {
+		if len(parts[i].Name) != len(parts[j].Name) {
+			return len(parts[i].Name) < len(parts[j].Name)
+		}
+		return parts[i].Name < parts[j].Name
+	})
+	var buf bytes.Buffer
+	for _, part := range parts {
+		rc, err := part.Open()
+		if err != nil {
+			return "", err
+		}
+		err = xmlText(rc, &buf, strings.HasSuffix(part.Name, "content.xml"))
+		rc.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+	return tidy(buf.String()), nil
+}
+
+// xmlText writes the text from an OOXML or ODF document part to buf, with a line for each paragraph (or shared string).
+// In OOXML parts, text is within "t" elements. In ODF parts (odf is true), text is anywhere within paragraphs and headings.
+func xmlText(rdr io.Reader, buf *bytes.Buffer, odf bool) error {
+	dec := xml.NewDecoder(rdr)
+	var depth int // depth of the elements that hold text
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch el := tok.(type) {
+		case xml.StartElement:
+			switch {
+			case odf && (el.Name.Local == "p" || el.Name.Local == "h"), !odf && el.Name.Local == "t":
+				depth++
+			case odf && (el.Name.Local == "tab" || el.Name.Local == "s"), !odf && el.Name.Local == "tab":
+				buf.WriteString(" ")
+			}
+		case xml.EndElement:
+			switch el.Name.Local {
+			case "p", "h", "si":
+				buf.WriteString("\n")
+			}
+			if (odf && (el.Name.Local == "p" || el.Name.Local == "h")) || (!odf && el.Name.Local == "t") {
+				depth--
+			}
+		case xml.CharData:
+			if depth > 0 {
+				buf.Write(el)
+			}
+		}
+	}
+}
+
+// EmailText is an Extractor for email messages (eml files). The text includes the From, To, Cc, Date and Subject
+// headers and the plain text body of the message (or its HTML body if there is no plain text). Attachments are ignored.
+func EmailText(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	msg, err := mail.ReadMessage(f)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	dec := new(mime.WordDecoder)
+	for _, h := range []string{"From", "To", "Cc", "Date", "Subject"} {
+		if v := msg.Header.Get(h); v != "" {
+			if d, err := dec.DecodeHeader(v); err == nil {
+				v = d
+			}
+			buf.WriteString(h + ": " + v + "\n")
+		}
+	}
+	body, err := emailBody(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), msg.Body)
+	if err != nil {
+		return "", err
+	}
+	buf.WriteString("\n" + body)
+	return buf.String(), nil
+}
+
+// emailBody returns the text of a message body, or of a multipart body's first plain text (or HTML) part
+func emailBody(ctype, encoding string, body io.Reader) (string, error) {
+	mt, params, err := mime.ParseMediaType(ctype)
+	if err != nil {
+		mt = "text/plain" // the default content type for email
+	}
+	if strings.HasPrefix(mt, "multipart/") {
+		var alt string
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				return alt, nil
+			}
+			if err != nil {
+				return "", err
+			}
+			if disp, _, _ := mime.ParseMediaType(part.Header.Get("Content-Disposition")); disp == "attachment" {
+				continue
+			}
+			text, err := emailBody(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part)
+			if err != nil {
+				return "", err
+			}
+			pt, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+			if pt == "" || pt == "text/plain" || (strings.HasPrefix(pt, "multipart/") && text != "") {
+				return text, nil
+			}
+			if alt == "" {
+				alt = text
+			}
+		}
+	}
+	byt, err := ioutil.ReadAll(transferDecoder(encoding, body))
+	if err != nil {
+		return "", err
+	}
+	switch mt {
+	case "text/plain":
+		return string(byt), nil
+	case "text/html":
+		return htmlText(string(byt)), nil
+	}
+	return "", nil
+}
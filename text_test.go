@@ -0,0 +1,217 @@
+// Copyright 2018 State of New South Wales through the State Archives and Records Authority of NSW
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package meta
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHTMLText(t *testing.T) {
+	got := htmlText(`<html><head><title>Teddies</title><style>p {color: red}</style><script>var x = "<p>";</script></head>
+<body><!-- a comment --><h1>Teddy  bears</h1><p>Bears &amp; more<br/>bears</p></body></html>`)
+	if expect := "Teddies\nTeddy bears\nBears & more\nbears"; got != expect {
+		t.Errorf("Expecting %q, got %q", expect, got)
+	}
+}
+
+// writeZip writes a zip file with the given file names and contents
+func writeZip(t *testing.T, path string, files map[string]string) {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := zip.NewWriter(f)
+	for name, content := range files {
+		fw, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte(content))
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+}
+
+func TestOfficeText(t *testing.T) {
+	dir, err := ioutil.TempDir("", "meta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	docx := filepath.Join(dir, "a.docx")
+	writeZip(t, docx, map[string]string{
+		"word/document.xml": `<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>` +
+			`<w:p><w:r><w:t>Hello</w:t></w:r><w:r><w:t xml:space="preserve"> world</w:t></w:r></w:p>` +
+			`<w:p><w:r><w:t>Second paragraph</w:t></w:r></w:p></w:body></w:document>`,
+	})
+	if got, err := OfficeText(docx); err != nil || got != "Hello world\nSecond paragraph" {
+		t.Errorf("Unexpected docx text %q (%v)", got, err)
+	}
+	odt := filepath.Join(dir, "a.odt")
+	writeZip(t, odt, map[string]string{
+		"content.xml": `<office:document-content xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0" xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0">` +
+			`<office:body><office:text><text:h>Heading</text:h><text:p>Some <text:span>styled</text:span> text</text:p></office:text></office:body></office:document-content>`,
+	})
+	if got, err := OfficeText(odt); err != nil || got != "Heading\nSome styled text" {
+		t.Errorf("Unexpected odt text %q (%v)", got, err)
+	}
+}
+
+const testEmail = "From: Richard Lehane <richard@example.com>\r\n" +
+	"To: Archives <archives@example.com>\r\n" +
+	"Subject: =?utf-8?q?Caf=C3=A9_meeting?=\r\n" +
+	"Date: Mon, 20 Apr 2015 17:41:48 +1000\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=\"XXX\"\r\n" +
+	"\r\n" +
+	"--XXX\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"See you at the caf=C3=A9.\r\n" +
+	"--XXX\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"Content-Disposition: attachment; filename=\"notes.txt\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"bm90ZXM=\r\n" +
+	"--XXX--\r\n"
+
+func TestEmailText(t *testing.T) {
+	dir, err := ioutil.TempDir("", "meta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "a.eml")
+	if err = ioutil.WriteFile(path, []byte(testEmail), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	got, err := EmailText(path)
+	expect := "From: Richard Lehane <richard@example.com>\nTo: Archives <archives@example.com>\nDate: Mon, 20 Apr 2015 17:41:48 +1000\nSubject: Café meeting\n\nSee you at the café."
+	if err != nil || got != expect {
+		t.Errorf("Expecting %q, got %q (%v)", expect, got, err)
+	}
+}
+
+func TestExtractText(t *testing.T) {
+	target, err := ioutil.TempDir("", "meta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(target)
+	if err = os.MkdirAll(filepath.Join(target, "versions", "0", "web"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(target, "versions", "0", "web", "index.html"), []byte("<p>Hello</p>"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	m := testMeta(1)
+	m.LogEvents = true
+	man := m.Manifest[m.Index[0]]
+	man.AddVersion([]File{{Name: "logo.png", MIME: "image/png"}, {Name: "web/index.html", MIME: "text/html; charset=utf-8"}})
+	man.AccessRules, _, _ = AppendAR(nil, "2016-05-23", "global", true, 0, "", []FileTarget{{0, 1}}, nil, nil)
+	if err = ExtractText(nil)(m, target, m.Index[0]); err != nil {
+		t.Fatal(err)
+	}
+	byt, err := ioutil.ReadFile(filepath.Join(target, "versions", "1", "web", "index.txt"))
+	if err != nil || string(byt) != "Hello" {
+		t.Fatalf("Expecting extracted text, got %q (%v)", byt, err)
+	}
+	if len(man.Versions) != 2 || len(man.Versions[1].Files) != 1 || man.Versions[1].DerivedFrom != "_:v0" || man.Versions[1].GeneratedBy != "log:0" {
+		t.Fatalf("Unexpected versions %v", man.Versions)
+	}
+	if txt, ok := man.AccessRules[0].Text.(string); !ok || txt != "_:v1f0" {
+		t.Errorf("Expecting text target to be _:v1f0, got %v", man.AccessRules[0].Text)
+	}
+	if errs := ValidateManifest(m.Index[0], man, m.Logs[m.Index[0]]); errs != nil {
+		t.Error(errs)
+	}
+}
+
+func TestExtractTextFailure(t *testing.T) {
+	target, err := ioutil.TempDir("", "meta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(target)
+	if err = os.MkdirAll(filepath.Join(target, "versions", "0"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"bad.docx": "not a zip", "index.html": "<p>Hello</p>"} {
+		if err = ioutil.WriteFile(filepath.Join(target, "versions", "0", name), []byte(content), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := testMeta(1)
+	m.LogEvents, m.CollectErrors = true, true
+	man := m.Manifest[m.Index[0]]
+	man.AddVersion([]File{
+		{Name: "bad.docx", MIME: "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+		{Name: "index.html", MIME: "text/html"},
+	})
+	if err = ExtractText(nil)(m, target, m.Index[0]); err != nil {
+		t.Fatal(err)
+	}
+	if len(man.Versions) != 2 || len(man.Versions[1].Files) != 1 || man.Versions[1].Files[0].Name != "index.txt" {
+		t.Fatalf("Expecting text from the html file despite the failure, got %v", man.Versions)
+	}
+	if fs := m.Failed(); len(fs) != 1 || fs[0].Action != "meta.ExtractText" {
+		t.Errorf("Expecting the failed extraction to be recorded, got %v", fs)
+	}
+	logs := m.Logs[m.Index[0]]
+	if len(logs) != 2 || logs[0].Outcome != OutcomeFailure || logs[0].Sources[0] != "_:v0f0" || man.Versions[1].GeneratedBy != "log:1" {
+		t.Errorf("Expecting a failure log and a log for the new version, got %v", logs)
+	}
+	m.CollectErrors = false
+	if err = ExtractText(nil)(m, target, m.Index[0]); err == nil {
+		t.Error("Expecting an error when not collecting errors")
+	}
+}
+
+func TestExtractTextMigrated(t *testing.T) {
+	target, err := ioutil.TempDir("", "meta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(target)
+	if err = os.MkdirAll(filepath.Join(target, "versions", "1"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(target, "versions", "1", "a.html"), []byte("<p>Hello</p>"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	m := testMeta(1)
+	index := m.Index[0]
+	man := m.Manifest[index]
+	man.AddVersion([]File{{Name: "a.wpd", MIME: "application/vnd.wordperfect"}})
+	man.AddVersion([]File{{Name: "a.html", MIME: "text/html"}})
+	// the display target is the original file, which has been migrated to HTML
+	man.AccessRules, _, _ = AppendAR(nil, "2016-05-23", "global", true, 0, "", []FileTarget{{0, 0}}, nil, nil)
+	l := m.AddLog(index, MigrationEvent).Link([]string{"_:v0f0"}, []string{"_:v1f0"})
+	man.Versions[1].DerivedFrom, man.Versions[1].GeneratedBy = "_:v0", l.ID
+	if err = ExtractText(nil)(m, target, index); err != nil {
+		t.Fatal(err)
+	}
+	if txt, ok := man.AccessRules[0].Text.(string); !ok || txt != "_:v2f0" {
+		t.Errorf("Expecting the text of the migrated file to be the text target, got %v", man.AccessRules[0].Text)
+	}
+}
@@ -0,0 +1,234 @@
+// Copyright 2018 State of New South Wales through the State Archives and Records Authority of NSW
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package meta
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// unpacker writes the members of an object's archives to the folder of a new version for the Decompress action,
+// along with copies of the other files in the archives' version. It enforces the Limits and records the members it rejects.
+type unpacker struct {
+	limits   Limits
+	dir      string // the new version's folder
+	files    []File
+	carried  int              // the number of files that are copies rather than archive members
+	derived  map[string][]int // maps the @ids of archives, and other files, to the indexes of their members or copies
+	total    int64
+	rejected []string
+	arc      File   // the archive being unpacked
+	prefix   string // folder within the new version for the archive's members
+}
+
+func newUnpacker(limits Limits, dir string) *unpacker {
+	return &unpacker{
+		limits:  limits,
+		dir:     dir,
+		derived: make(map[string][]int),
+	}
+}
+
+var zipFolders = strings.NewReplacer(".zip#", "_zip/")
+
+// next starts unpacking an archive, with its members written to the prefix folder (e.g. a_zip/) within the version
+func (u *unpacker) next(arc File, prefix string) {
+	u.arc, u.prefix = arc, prefix
+}
+
+func (u *unpacker) reject(name, reason string) {
+	u.rejected = append(u.rejected, u.arc.Name+"#"+strings.TrimPrefix(name, "#")+" ("+reason+")")
+}
+
+// admit reports whether an archive member, with its declared size, is within the Files and Bytes limits
+func (u *unpacker) admit(name string, size int64) bool {
+	if u.limits.Files > 0 && len(u.files) >= u.limits.Files {
+		u.reject(name, "exceeds the limit of "+strconv.Itoa(u.limits.Files)+" files")
+		return false
+	}
+	if u.limits.Bytes > 0 && u.total+size > u.limits.Bytes {
+		u.reject(name, "exceeds the limit of "+strconv.FormatInt(u.limits.Bytes, 10)+" bytes")
+		return false
+	}
+	return true
+}
+
+// nest reports whether a nested archive, at the given depth, is within the Depth limit and should be unpacked
+func (u *unpacker) nest(name string, depth int) bool {
+	if u.limits.Depth == 0 || depth < u.limits.Depth {
+		return true
+	}
+	u.reject(name, "not unpacked as it exceeds the nesting limit of "+strconv.Itoa(u.limits.Depth))
+	return false
+}
+
+// write writes an archive member to the version's folder and adds it to the unpacked files.
+// The name is the member's container-internal path (e.g. #folder/file.txt) and mod is its modification time in the archive.
+func (u *unpacker) write(name string, rdr io.Reader, mod time.Time, puid, mime string) error {
+	orig := strings.TrimPrefix(name, "#")
+	path := zipFolders.Replace(orig)
+	if !safePath(path) {
+		u.reject(name, "unsafe path")
+		return nil
+	}
+	path = u.prefix + strings.Replace(path, "\\", "/", -1)
+	out := filepath.Join(u.dir, filepath.FromSlash(path))
+	if err := os.MkdirAll(filepath.Dir(out), os.ModePerm); err != nil {
+		return err
+	}
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	// the declared size of an archive member can't be trusted, so stop copying at the bytes limit
+	if u.limits.Bytes > 0 {
+		rdr = io.LimitReader(rdr, u.limits.Bytes-u.total+1)
+	}
+	n, err := io.Copy(f, rdr)
+	if err != nil && err.Error() == "empty source" {
+		err = nil
+	}
+	f.Close()
+	if err != nil {
+		return err
+	}
+	if u.limits.Bytes > 0 && u.total+n > u.limits.Bytes {
+		u.reject(name, "exceeds the limit of "+strconv.FormatInt(u.limits.Bytes, 10)+" bytes")
+		return os.Remove(out)
+	}
+	u.total += n
+	if !mod.IsZero() { // keep the modification time stored in the archive
+		if err = os.Chtimes(out, mod, mod); err != nil {
+			return err
+		}
+	}
+	fi, err := os.Stat(out)
+	if err != nil {
+		return err
+	}
+	t := fi.ModTime()
+	u.derived[u.arc.ID] = append(u.derived[u.arc.ID], len(u.files))
+	u.files = append(u.files, File{
+		Name:         path,
+		OriginalName: u.arc.Name + "#" + orig,
+		Size:         fi.Size(),
+		Modified:     &t,
+		MIME:         mime,
+		PUID:         ToPUID(puid),
+	})
+	return nil
+}
+
+// carry copies a file that isn't an archive from the archives' version folder (srcdir) to the new version
+func (u *unpacker) carry(f File, srcdir string) error {
+	out := filepath.Join(u.dir, filepath.FromSlash(f.Name))
+	if err := os.MkdirAll(filepath.Dir(out), os.ModePerm); err != nil {
+		return err
+	}
+	if err := copyFile(filepath.Join(srcdir, filepath.FromSlash(f.Name)), out); err != nil {
+		return err
+	}
+	u.derived[f.ID] = []int{len(u.files)}
+	u.files = append(u.files, f)
+	u.carried++
+	return nil
+}
+
+// copyFile copies the file at src to dst, preserving its modified time
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(dst, fi.ModTime(), fi.ModTime())
+}
+
+// finish adds the unpacked files to an object's manifest as a version derived from version vidx, which holds the archives.
+// Access rule targets (display, preview and text) that refer to an archive are updated to refer to its members instead,
+// and those that refer to other files are updated to refer to their copies.
+// An unpacking event is logged if the Meta's LogEvents field is set or if any archive members were rejected.
+func (u *unpacker) finish(m *Meta, index string, vidx int, start time.Time, archives []string) {
+	man := m.Manifest[index]
+	man.AddVersion(u.files)
+	v := &man.Versions[len(man.Versions)-1]
+	v.DerivedFrom = ReferenceVersion(vidx)
+	if m.LogEvents || len(u.rejected) > 0 {
+		end := time.Now()
+		names := make([]string, len(archives))
+		for i, ref := range archives {
+			ft, _ := ParseFileTarget(ref)
+			names[i] = man.Versions[ft[0]].Files[ft[1]].Name
+		}
+		l := m.AddLog(index, UnpackingEvent)
+		l.Start, l.End, l.Agent = &start, &end, Tool
+		l.Detail = "Unpacked " + strconv.Itoa(len(u.files)-u.carried) + " files from " + strings.Join(names, ", ")
+		l.SetOutcome(OutcomeSuccess, "")
+		if len(u.rejected) > 0 {
+			l.SetOutcome(OutcomeWarning, "Rejected "+strconv.Itoa(len(u.rejected))+" archive members: "+strings.Join(u.rejected, "; "))
+		}
+		l.Link(archives, nil)
+		v.GeneratedBy = l.ID
+	}
+	vnew := len(man.Versions) - 1
+	remap := func(v VarStr) VarStr {
+		targets := strs(v)
+		refs := make([]string, 0, len(targets))
+		var changed bool
+		for _, ref := range targets {
+			idxs, ok := u.derived[ref]
+			if !ok {
+				refs = append(refs, ref)
+				continue
+			}
+			changed = true
+			for _, idx := range idxs {
+				refs = append(refs, FileTarget{vnew, idx}.String())
+			}
+		}
+		switch {
+		case !changed:
+			return v
+		case len(refs) == 0:
+			return nil
+		case len(refs) == 1:
+			return refs[0]
+		}
+		return refs
+	}
+	for i := range man.AccessRules {
+		ar := &man.AccessRules[i]
+		ar.Display, ar.Preview, ar.Text = remap(ar.Display), remap(ar.Preview), remap(ar.Text)
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2018 State of New South Wales through the State Archives and Records Authority of NSW
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package meta
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUnpackerLimits(t *testing.T) {
+	target, err := ioutil.TempDir("", "meta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(target)
+	m := testMeta(1)
+	index := m.Index[0]
+	man := m.Manifest[index]
+	man.AddVersion([]File{{Name: "a.zip"}})
+	u := newUnpacker(Limits{Bytes: 10, Files: 3, Depth: 1}, filepath.Join(target, "versions", "1"))
+	u.next(File{ID: "_:v0f0", Name: "a.zip"}, "")
+	mod := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	for _, tc := range []struct {
+		name    string
+		size    int64 // declared size
+		content string
+		admit   bool
+		written bool
+	}{
+		{"#ok.txt", 4, "1234", true, true},
+		{"#../evil.txt", 1, "x", true, false},      // unsafe path
+		{"#liar.txt", 1, "123456789", true, false}, // real size exceeds the bytes limit
+		{"#big.txt", 7, "1234567", false, false},   // declared size exceeds the bytes limit
+		{"#folder/ok.txt", 2, "12", true, true},
+		{"#folder\\also ok.txt", 2, "12", true, true}, // a Windows path
+		{"#one too many.txt", 1, "1", false, false},   // exceeds the files limit
+	} {
+		if admit := u.admit(tc.name, tc.size); admit != tc.admit {
+			t.Errorf("%s: expecting admit to be %v", tc.name, tc.admit)
+		}
+		if !tc.admit {
+			continue
+		}
+		n := len(u.files)
+		if err = u.write(tc.name, strings.NewReader(tc.content), mod, "x-fmt/111", "text/plain"); err != nil {
+			t.Fatal(err)
+		}
+		if written := len(u.files) > n; written != tc.written {
+			t.Errorf("%s: expecting written to be %v", tc.name, tc.written)
+		}
+	}
+	if !u.nest("#inner.zip", 0) || u.nest("#inner.zip#nested.zip", 1) {
+		t.Error("Expecting nested archives to be unpacked to a depth of 1")
+	}
+	if len(u.files) != 3 || u.total != 8 || len(u.rejected) != 5 {
+		t.Fatalf("Unexpected unpacking: %d files, %d bytes, rejected %v", len(u.files), u.total, u.rejected)
+	}
+	if f := u.files[2]; f.Name != "folder/also ok.txt" || f.OriginalName != "a.zip#folder\\also ok.txt" || !f.Modified.Equal(mod) {
+		t.Errorf("Unexpected file %v", f)
+	}
+	for _, name := range []string{"evil.txt", filepath.Join("versions", "1", "liar.txt")} {
+		if _, err = os.Stat(filepath.Join(target, name)); !os.IsNotExist(err) {
+			t.Errorf("Expecting %s not to be written, got %v", name, err)
+		}
+	}
+	// the rejections are logged, even though LogEvents isn't set
+	u.finish(m, index, 0, time.Now(), []string{"_:v0f0"})
+	logs := m.Logs[index]
+	if len(logs) != 1 || logs[0].Typ != UnpackingEvent || logs[0].Outcome != OutcomeWarning || !strings.HasPrefix(logs[0].OutcomeDetail, "Rejected 5 archive members: a.zip#../evil.txt (unsafe path)") {
+		t.Fatalf("Expecting an unpacking log with a warning, got %v", logs)
+	}
+	if v := man.Versions[1]; v.DerivedFrom != "_:v0" || v.GeneratedBy != logs[0].ID || len(v.Files) != 3 {
+		t.Errorf("Unexpected version %v", v)
+	}
+	if errs := ValidateManifest(index, man, logs); errs != nil {
+		t.Error(errs)
+	}
+}
+
+func TestUnpackerArchives(t *testing.T) {
+	target, err := ioutil.TempDir("", "meta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(target)
+	srcdir := filepath.Join(target, "versions", "0")
+	if err = os.MkdirAll(srcdir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(srcdir, "readme.txt"), []byte("readme"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	m := testMeta(1)
+	m.LogEvents = true
+	index := m.Index[0]
+	man := m.Manifest[index]
+	man.AddVersion([]File{{Name: "a.zip"}, {Name: "readme.txt"}, {Name: "b.zip"}})
+	man.AccessRules, _, _ = AppendAR(nil, "2016-05-23", "global", true, 0, "", []FileTarget{{0, 0}, {0, 1}}, nil, nil)
+	man.AccessRules, _, _ = AppendAR(man.AccessRules, "2016-05-23", "global", true, 0, "", []FileTarget{{0, 2}}, nil, nil)
+	man.AccessRules[0].Preview = FileTarget{0, 1}.String()
+	man.AccessRules[1].Text = FileTarget{0, 2}.String()
+	// unpack the archives, and copy the other file, as Decompress does
+	u := newUnpacker(Limits{}, filepath.Join(target, "versions", "1"))
+	members := map[string][]string{"a.zip": {"#x.txt"}, "b.zip": {"#x.txt", "#folder/y.txt"}}
+	for i, f := range man.Versions[0].Files {
+		f.ID = FileTarget{0, i}.String()
+		if f.Name == "readme.txt" {
+			if err = u.carry(f, srcdir); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		u.next(f, arcFolder(f.Name))
+		for _, name := range members[f.Name] {
+			if err = u.write(name, strings.NewReader(name), time.Time{}, "x-fmt/111", "text/plain"); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	u.finish(m, index, 0, time.Now(), []string{"_:v0f0", "_:v0f2"})
+	v := man.Versions[1]
+	var names []string
+	for _, f := range v.Files {
+		names = append(names, f.Name)
+	}
+	if strings.Join(names, ",") != "a_zip/x.txt,readme.txt,b_zip/x.txt,b_zip/folder/y.txt" || v.DerivedFrom != "_:v0" {
+		t.Fatalf("Expecting the members of both archives and the other file in the derived version, got %v", v)
+	}
+	for _, name := range names {
+		if _, err = os.Stat(filepath.Join(target, "versions", "1", filepath.FromSlash(name))); err != nil {
+			t.Error(err)
+		}
+	}
+	if d := strs(man.AccessRules[0].Display); strings.Join(d, ",") != "_:v1f0,_:v1f1" {
+		t.Errorf("Expecting the first access rule to display the first archive's members and the copied file, got %v", d)
+	}
+	if d := strs(man.AccessRules[1].Display); strings.Join(d, ",") != "_:v1f2,_:v1f3" {
+		t.Errorf("Expecting the second access rule to display the second archive's members, got %v", d)
+	}
+	if p := strs(man.AccessRules[0].Preview); strings.Join(p, ",") != "_:v1f1" {
+		t.Errorf("Expecting the first access rule's preview to be the copied file, got %v", p)
+	}
+	if txt := strs(man.AccessRules[1].Text); strings.Join(txt, ",") != "_:v1f2,_:v1f3" {
+		t.Errorf("Expecting the second access rule's text to be the second archive's members, got %v", txt)
+	}
+	if l := m.Logs[index]; len(l) != 1 || l[0].Detail != "Unpacked 3 files from a.zip, b.zip" || l[0].Outcome != OutcomeSuccess || v.GeneratedBy != l[0].ID {
+		t.Errorf("Unexpected unpacking log %v", l)
+	}
+	if errs := ValidateManifest(index, man, m.Logs[index]); errs != nil {
+		t.Error(errs)
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2018 State of New South Wales through the State Archives and Records Authority of NSW
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package meta
+
+import (
+	"fmt"
+	"strings"
+)
+
+// BrokenRef describes a broken internal reference within a manifest
+type BrokenRef struct {
+	Index string // index of the object in the Meta
+	Field string // field that holds the reference e.g. displayTarget
+	From  string // @id of the access rule, version or file that holds the reference
+	Ref   string // the broken reference
+	Msg   string
+}
+
+func (b BrokenRef) Error() string {
+	return fmt.Sprintf("%s: %s of %s has broken reference %q: %s", b.Index, b.Field, b.From, b.Ref, b.Msg)
+}
+
+// Invalid is the error returned by Validate. It lists all the broken references found.
+type Invalid []BrokenRef
+
+func (inv Invalid) Error() string {
+	msgs := make([]string, len(inv))
+	for i, b := range inv {
+		msgs[i] = b.Error()
+	}
+	return fmt.Sprintf("meta: %d broken references\n%s", len(inv), strings.Join(msgs, "\n"))
+}
+
+// Validate checks the manifests of all objects in a Meta for broken internal references:
+// - display, preview and text targets must refer to files that exist in the manifest (e.g. _:v0f0),
+// - hasAccessRules entries must refer to access rules that exist in the manifest (e.g. _:ar0),
+// - the isPartOf of files must refer to files that exist in the manifest,
+// - derivedFrom must refer to an earlier version, and
+// - generatedBy must refer to a log that exists in the object's Logs (e.g. log:0), and
+// - the sources and outputs of logs must refer to files that exist in the manifest.
+// Returns an Invalid error if any broken references are found.
+func (m *Meta) Validate() error {
+	var inv Invalid
+	for _, idx := range m.Index {
+		man, ok := m.Manifest[idx]
+		if !ok {
+			continue
+		}
+		inv = append(inv, ValidateManifest(idx, man, m.Logs[idx])...)
+	}
+	if len(inv) > 0 {
+		return inv
+	}
+	return nil
+}
+
+// ValidateManifest checks a single manifest, and the logs for that object, for broken internal references.
+// The index is used to label any BrokenRefs returned.
+func ValidateManifest(index string, man *Manifest, logs []*Log) []BrokenRef {
+	var ret []BrokenRef
+	broken := func(field, from, ref, msg string) {
+		ret = append(ret, BrokenRef{index, field, from, ref, msg})
+	}
+	ars := make(map[string]bool)
+	for _, ar := range man.AccessRules {
+		ars[ar.ID] = true
+	}
+	lgs := make(map[string]bool)
+	for _, l := range logs {
+		lgs[l.ID] = true
+	}
+	fileExists := func(ref string) string {
+		ft, err := ParseFileTarget(ref)
+		if err != nil {
+			return "not a file reference"
+		}
+		if ft[0] < 0 || ft[1] < 0 || ft[0] >= len(man.Versions) || ft[1] >= len(man.Versions[ft[0]].Files) {
+			return "no such file"
+		}
+		return ""
+	}
+	for _, ar := range man.AccessRules {
+		for _, t := range []struct {
+			field string
+			v     VarStr
+		}{
+			{"displayTarget", ar.Display},
+			{"previewTarget", ar.Preview},
+			{"textTarget", ar.Text},
+		} {
+			for _, ref := range strs(t.v) {
+				if msg := fileExists(ref); msg != "" {
+					broken(t.field, ar.ID, ref, msg)
+				}
+			}
+		}
+	}
+	for i, v := range man.Versions {
+		for _, ref := range v.HasAccessRules {
+			if !ars[ref] {
+				broken("hasAccessRules", v.ID, ref, "no such access rule")
+			}
+		}
+		if v.DerivedFrom != "" {
+			if n, err := ParseVersion(v.DerivedFrom); err != nil {
+				broken("derivedFrom", v.ID, v.DerivedFrom, "not a version reference")
+			} else if n >= i {
+				broken("derivedFrom", v.ID, v.DerivedFrom, "not an earlier version")
+			}
+		}
+		if v.GeneratedBy != "" && !lgs[v.GeneratedBy] {
+			broken("generatedBy", v.ID, v.GeneratedBy, "no such log")
+		}
+		for _, f := range v.Files {
+			for _, ref := range f.HasAccessRules {
+				if !ars[ref] {
+					broken("hasAccessRules", f.ID, ref, "no such access rule")
+				}
+			}
+			if f.IsPartOf != "" {
+				if msg := fileExists(f.IsPartOf); msg != "" {
+					broken("isPartOf", f.ID, f.IsPartOf, msg)
+				}
+			}
+		}
+	}
+	for _, l := range logs {
+		for _, t := range []struct {
+			field string
+			refs  []string
+		}{
+			{"source", l.Sources},
+			{"output", l.Outputs},
+		} {
+			for _, ref := range t.refs {
+				if msg := fileExists(ref); msg != "" {
+					broken(t.field, l.ID, ref, msg)
+				}
+			}
+		}
+	}
+	return ret
+}
@@ -0,0 +1,70 @@
+// Copyright 2018 State of New South Wales through the State Archives and Records Authority of NSW
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package meta
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	m, err := New(SIPDir(filepath.Join("examples", "project-0")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = m.Validate(); err != nil {
+		t.Fatalf("Expecting example project to be valid, got %v", err)
+	}
+	man := m.Manifest[m.Index[0]]
+	man.AccessRules[0].Display = ReferenceFiles([]FileTarget{{0, 0}, {0, 1}})
+	man.AccessRules[0].Text = "_:v2f0"
+	man.AccessRules[0].Preview = []string{"_:v-1f0", "_:v0f-1"}
+	man.Versions[0].HasAccessRules = []string{"_:ar1"}
+	man.Versions[0].DerivedFrom = ReferenceVersion(1)
+	man.Versions[1].GeneratedBy = ReferenceLog(1)
+	man.Versions[1].Files[0].IsPartOf = "_:v5f0"
+	m.Logs[m.Index[0]][0].Link([]string{"_:v0f0"}, []string{"_:v1f3"})
+	err = m.Validate()
+	inv, ok := err.(Invalid)
+	if !ok {
+		t.Fatalf("Expecting an Invalid error, got %v", err)
+	}
+	if len(inv) != 9 {
+		t.Fatalf("Expecting 9 broken references, got %d: %v", len(inv), inv)
+	}
+}
+
+func TestParseFileTarget(t *testing.T) {
+	ft, err := ParseFileTarget("_:v12f3")
+	if err != nil || ft != (FileTarget{12, 3}) {
+		t.Errorf("Expecting _:v12f3 to parse as {12 3}, got %v (%v)", ft, err)
+	}
+	for _, bad := range []string{"_:v1", "_:ar0", "_:v01f1", "v1f1", "_:vf1", "_:v-1f0", "_:v0f-1"} {
+		if _, err = ParseFileTarget(bad); err == nil {
+			t.Errorf("Expecting %s to fail to parse", bad)
+		}
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	if v, err := ParseVersion("_:v3"); err != nil || v != 3 {
+		t.Errorf("Expecting _:v3 to parse as 3, got %d (%v)", v, err)
+	}
+	for _, bad := range []string{"_:v-1", "_:v01", "_:ar0", "v1"} {
+		if _, err := ParseVersion(bad); err == nil {
+			t.Errorf("Expecting %s to fail to parse", bad)
+		}
+	}
+}
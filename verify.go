@@ -0,0 +1,144 @@
+// Copyright 2018 State of New South Wales through the State Archives and Records Authority of NSW
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package meta
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Problems found when verifying the files in a SIP against its manifest
+const (
+	MissingFile    = "missing file"    // a file listed in the manifest isn't in the SIP
+	ExtraFile      = "extra file"      // a file in the SIP's versions folder isn't listed in the manifest
+	SizeMismatch   = "size mismatch"   // a file's size doesn't match the manifest
+	HashMismatch   = "hash mismatch"   // a file's hash doesn't match the manifest
+	UnverifiedHash = "unverified hash" // a hash in the manifest uses an algorithm that can't be checked
+)
+
+// Discrepancy describes a difference between the files in a SIP and its manifest
+type Discrepancy struct {
+	SIP     string // path to the SIP directory
+	Path    string // path to the file, relative to the SIP directory
+	Problem string // e.g. MissingFile
+	Detail  string
+}
+
+func (d Discrepancy) String() string {
+	if d.Detail == "" {
+		return fmt.Sprintf("%s: %s %s", d.SIP, d.Problem, d.Path)
+	}
+	return fmt.Sprintf("%s: %s %s (%s)", d.SIP, d.Problem, d.Path, d.Detail)
+}
+
+// Verify audits all the SIPs in an output directory generated by Output.
+// Each SIP's manifest.json is re-read and the files in its versions folders are checked for missing files,
+// extra files not listed in the manifest, size mismatches and hash mismatches.
+// An error is returned if a manifest can't be read or a file can't be hashed.
+func Verify(dir string) ([]Discrepancy, error) {
+	sips, err := ListSIPs(dir)
+	if err != nil {
+		return nil, err
+	}
+	var ret []Discrepancy
+	for _, sip := range sips {
+		man := &Manifest{}
+		if err := readJSON(filepath.Join(sip, "manifest.json"), man); err != nil {
+			return nil, err
+		}
+		ds, err := VerifySIP(sip, man)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, ds...)
+	}
+	return ret, nil
+}
+
+// VerifySIP checks the files in a SIP directory against the supplied manifest.
+// Files are expected at their version's base joined with their name e.g. versions/0/file.pdf.
+func VerifySIP(dir string, man *Manifest) ([]Discrepancy, error) {
+	var ret []Discrepancy
+	report := func(path, problem, detail string) {
+		ret = append(ret, Discrepancy{dir, path, problem, detail})
+	}
+	listed := make(map[string]bool)
+	for vidx, v := range man.Versions {
+		base := v.Base
+		if base == "" {
+			base = "versions/" + strconv.Itoa(vidx)
+		}
+		for _, f := range v.Files {
+			rel := filepath.Join(filepath.FromSlash(base), filepath.FromSlash(f.Name))
+			listed[rel] = true
+			fi, err := os.Stat(filepath.Join(dir, rel))
+			if err != nil {
+				if os.IsNotExist(err) {
+					report(rel, MissingFile, "")
+					continue
+				}
+				return nil, err
+			}
+			if fi.Size() != f.Size {
+				report(rel, SizeMismatch, fmt.Sprintf("manifest has %d bytes, file has %d bytes", f.Size, fi.Size()))
+			}
+			var check []Hash
+			var algs []string
+			for _, h := range f.AllHashes() {
+				if _, err := newHash(h.Algorithm); err != nil {
+					report(rel, UnverifiedHash, h.Algorithm)
+					continue
+				}
+				check = append(check, h)
+				algs = append(algs, h.Algorithm)
+			}
+			if len(algs) == 0 {
+				continue
+			}
+			got, err := HashFile(filepath.Join(dir, rel), algs...)
+			if err != nil {
+				return nil, err
+			}
+			for i, h := range check {
+				if !strings.EqualFold(h.Value, got[i].Value) {
+					report(rel, HashMismatch, fmt.Sprintf("manifest has %s %s, file has %s", h.Algorithm, h.Value, got[i].Value))
+				}
+			}
+		}
+	}
+	err := filepath.Walk(filepath.Join(dir, "versions"), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if !listed[rel] {
+			report(rel, ExtraFile, "")
+		}
+		return nil
+	})
+	return ret, err
+}
@@ -0,0 +1,82 @@
+// Copyright 2018 State of New South Wales through the State Archives and Records Authority of NSW
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package meta
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	src, err := ioutil.TempDir("", "meta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+	dst, err := ioutil.TempDir("", "meta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dst)
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		if err = ioutil.WriteFile(filepath.Join(src, name), []byte("contents of "+name), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := testMeta(1)
+	m.Manifest["object0"].AddVersion([]File{{Name: "a.txt", Size: 17}, {Name: "b.txt", Size: 17}, {Name: "c.txt", Size: 17}})
+	pathfunc := func(m *Meta, index string) string { return src }
+	if err = m.Output(dst, ManifestCopy(pathfunc, SHA1)); err != nil {
+		t.Fatal(err)
+	}
+	ds, err := Verify(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ds) != 0 {
+		t.Fatalf("Expecting no discrepancies, got %v", ds)
+	}
+	base := filepath.Join(dst, "0", "versions", "0")
+	os.Remove(filepath.Join(base, "a.txt"))
+	ioutil.WriteFile(filepath.Join(base, "b.txt"), []byte("short"), os.ModePerm)
+	ioutil.WriteFile(filepath.Join(base, "c.txt"), []byte("CONTENTS OF c.txt"), os.ModePerm)
+	ioutil.WriteFile(filepath.Join(base, "Thumbs.db"), []byte("extra"), os.ModePerm)
+	ds, err = Verify(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// b.txt has both the wrong size and the wrong hash
+	expect := map[string][]string{
+		"a.txt":     {MissingFile},
+		"b.txt":     {SizeMismatch, HashMismatch},
+		"c.txt":     {HashMismatch},
+		"Thumbs.db": {ExtraFile},
+	}
+	got := make(map[string][]string)
+	for _, d := range ds {
+		got[filepath.Base(d.Path)] = append(got[filepath.Base(d.Path)], d.Problem)
+	}
+	if len(ds) != 5 || len(got) != len(expect) {
+		t.Fatalf("Expecting 5 discrepancies, got %v", ds)
+	}
+	for name, problems := range expect {
+		if strings.Join(got[name], ", ") != strings.Join(problems, ", ") {
+			t.Errorf("Expecting %s to have problems %v, got %v", name, problems, got[name])
+		}
+	}
+}